@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	artifactsIndexFileName = "artifacts.json"
+	sha256SumsFileName     = "SHA256SUMS"
+)
+
+// artifact is a file produced by the Step.
+type artifact struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	EnvKey string `json:"envKey,omitempty"`
+}
+
+// artifactIndex collects the files produced by the Step, to be listed in artifacts.json and SHA256SUMS.
+type artifactIndex struct {
+	Artifacts []artifact `json:"artifacts"`
+}
+
+// add hashes the file and records it in the index. envKey is the Environment Variable
+// the file's path is exported under, it can be empty if the path is not exported.
+func (i *artifactIndex) add(pth, envKey string) error {
+	info, err := os.Stat(pth)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", pth)
+	}
+
+	checksum, err := fileSHA256(pth)
+	if err != nil {
+		return err
+	}
+
+	for idx, a := range i.Artifacts {
+		if a.Path == pth {
+			i.Artifacts = append(i.Artifacts[:idx], i.Artifacts[idx+1:]...)
+			break
+		}
+	}
+
+	i.Artifacts = append(i.Artifacts, artifact{
+		Path:   pth,
+		Size:   info.Size(),
+		SHA256: checksum,
+		EnvKey: envKey,
+	})
+	return nil
+}
+
+// sha256Sums returns the index in the `sha256sum` output format.
+// Paths inside the given directory are relative to it, so the file can be verified with `shasum -a 256 -c` from that directory.
+func (i artifactIndex) sha256Sums(dir string) string {
+	var lines []string
+	for _, a := range i.Artifacts {
+		name := a.Path
+		if rel, err := filepath.Rel(dir, a.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s", a.SHA256, name))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// json returns the index as indented JSON.
+func (i artifactIndex) json() (string, error) {
+	if i.Artifacts == nil {
+		i.Artifacts = []artifact{}
+	}
+
+	b, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactIndex(t *testing.T) {
+	outputDir := t.TempDir()
+	appZipPth := filepath.Join(outputDir, "App.app.zip")
+	if err := os.WriteFile(appZipPth, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	exportOptionsPth := filepath.Join(outputDir, "export_options.plist")
+	if err := os.WriteFile(exportOptionsPth, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var index artifactIndex
+	if err := index.add(appZipPth, bitriseExportedFilePath); err != nil {
+		t.Fatalf("add() error = %s", err)
+	}
+	if err := index.add(exportOptionsPth, ""); err != nil {
+		t.Fatalf("add() error = %s", err)
+	}
+	if err := index.add(appZipPth, bitriseExportedFilePath); err != nil {
+		t.Fatalf("add() error = %s", err)
+	}
+	if err := index.add(outputDir, ""); err == nil {
+		t.Errorf("add() expected error for directory")
+	}
+
+	wantSums := `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  export_options.plist
+2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  App.app.zip
+`
+	if got := index.sha256Sums(outputDir); got != wantSums {
+		t.Errorf("sha256Sums() = %v, want %v", got, wantSums)
+	}
+
+	got, err := index.json()
+	if err != nil {
+		t.Fatalf("json() error = %s", err)
+	}
+	for _, want := range []string{`"size": 5`, `"envKey": "BITRISE_EXPORTED_FILE_PATH"`, `"path": "` + appZipPth + `"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("json() = %s, expected to contain %s", got, want)
+		}
+	}
+}
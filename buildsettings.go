@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+const (
+	buildSettingSourceInput             = "build_settings"
+	buildSettingSourceXcodebuildOptions = "xcodebuild_options"
+)
+
+// buildSettingKeyPattern matches a build setting name, with optional conditions, e.g. `CODE_SIGN_IDENTITY[sdk=macosx*]`.
+var buildSettingKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[^\]]+\])*$`)
+
+// xcodebuildValueFlags are the xcodebuild flags followed by a value, the value may contain `=` (e.g. `-destination platform=macOS`).
+var xcodebuildValueFlags = map[string]bool{
+	"-project": true, "-workspace": true, "-target": true, "-scheme": true, "-configuration": true,
+	"-xcconfig": true, "-arch": true, "-sdk": true, "-toolchain": true, "-destination": true,
+	"-destination-timeout": true, "-jobs": true, "-derivedDataPath": true, "-archivePath": true,
+	"-resultBundlePath": true, "-resultStreamPath": true, "-clonedSourcePackagesDirPath": true,
+	"-packageCachePath": true, "-exportPath": true, "-exportOptionsPlist": true, "-testPlan": true,
+	"-only-testing": true, "-skip-testing": true, "-authenticationKeyPath": true, "-authenticationKeyID": true,
+	"-authenticationKeyIssuerID": true,
+}
+
+// buildSetting is a build setting passed to xcodebuild on the command line, with the input it comes from.
+type buildSetting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+func (s buildSetting) String() string {
+	return s.Key + "=" + s.Value
+}
+
+// parseBuildSettings parses the newline separated `KEY=VALUE` build settings input.
+// Empty lines and lines starting with `//` are ignored. Every invalid line is reported.
+func parseBuildSettings(input string) ([]buildSetting, error) {
+	var settings []buildSetting
+	var problems []string
+	firstLines := map[string]int{}
+
+	for i, line := range strings.Split(input, "\n") {
+		lineNumber := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		key, value, ok := splitBuildSetting(line)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("line %d: missing `=` in %q, use the KEY=VALUE format", lineNumber, line))
+			continue
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !buildSettingKeyPattern.MatchString(key) {
+			problems = append(problems, fmt.Sprintf("line %d: invalid build setting name %q", lineNumber, key))
+			continue
+		}
+		if first, ok := firstLines[key]; ok {
+			problems = append(problems, fmt.Sprintf("line %d: %s is already set on line %d", lineNumber, key, first))
+			continue
+		}
+		firstLines[key] = lineNumber
+
+		settings = append(settings, buildSetting{Key: key, Value: value, Source: buildSettingSourceInput})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid build settings:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return settings, nil
+}
+
+// splitBuildSetting splits a `KEY=VALUE` pair at the first `=` outside of the key's conditions (`KEY[sdk=macosx*]=VALUE`).
+func splitBuildSetting(s string) (string, string, bool) {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '=':
+			if depth == 0 {
+				return s[:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// splitXcodebuildOptions shell-splits the xcodebuild_options input.
+func splitXcodebuildOptions(options string) ([]string, error) {
+	if options == "" {
+		return nil, nil
+	}
+
+	args, err := shellquote.Split(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to shell split xcodebuild_options (%s), check the quoting: %s", options, err)
+	}
+	return args, nil
+}
+
+// xcodebuildOptionBuildSettings returns the `KEY=VALUE` build settings of the xcodebuild options.
+func xcodebuildOptionBuildSettings(args []string) []buildSetting {
+	var settings []buildSetting
+	for i, arg := range args {
+		if i > 0 && xcodebuildValueFlags[args[i-1]] {
+			continue
+		}
+
+		if key, value, ok := splitBuildSetting(arg); ok && buildSettingKeyPattern.MatchString(key) {
+			settings = append(settings, buildSetting{Key: key, Value: value, Source: buildSettingSourceXcodebuildOptions})
+		}
+	}
+	return settings
+}
+
+// hasXcodebuildFlag returns true if the flag is one of the xcodebuild options (and not the value of another flag).
+func hasXcodebuildFlag(args []string, flag string) bool {
+	for i, arg := range args {
+		if arg == flag && (i == 0 || !xcodebuildValueFlags[args[i-1]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// xcodebuildFlagValue returns the value of the flag in the xcodebuild options, or an empty string if it is not set.
+func xcodebuildFlagValue(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag && (i == 0 || !xcodebuildValueFlags[args[i-1]]) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// effectiveBuildSettings returns every build setting the archive command sets, from the xcodebuild_options,
+// the force_* and the build_settings inputs. A setting set by more than one input is an error.
+func effectiveBuildSettings(opts ArchiveCommandOpts) ([]buildSetting, error) {
+	args, err := splitXcodebuildOptions(opts.XcodebuildOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.XCConfigPath != "" && hasXcodebuildFlag(args, "-xcconfig") {
+		return nil, fmt.Errorf("both the xcconfig_path input and an -xcconfig flag in xcodebuild_options are set, use only one of them")
+	}
+
+	settings := xcodebuildOptionBuildSettings(args)
+	for _, forced := range []buildSetting{
+		{Key: "DEVELOPMENT_TEAM", Value: opts.ForceTeamID, Source: "force_team_id"},
+		{Key: "PROVISIONING_PROFILE_SPECIFIER", Value: opts.ForceProvisioningProfileSpecifier, Source: "force_provisioning_profile_specifier"},
+		{Key: "PROVISIONING_PROFILE", Value: opts.ForceProvisioningProfile, Source: "force_provisioning_profile"},
+		{Key: "CODE_SIGN_IDENTITY", Value: opts.ForceCodeSignIdentity, Source: "force_code_sign_identity"},
+	} {
+		if forced.Value != "" {
+			settings = append(settings, forced)
+		}
+	}
+	if opts.DisableIndexWhileBuilding {
+		settings = append(settings, buildSetting{Key: "COMPILER_INDEX_STORE_ENABLE", Value: "NO", Source: "disable_index_while_building"})
+	}
+	settings = append(settings, opts.BuildSettings...)
+
+	var conflicts []string
+	sources := map[string]buildSetting{}
+	for _, setting := range settings {
+		if previous, ok := sources[setting.Key]; ok && previous.Source != setting.Source {
+			conflicts = append(conflicts, fmt.Sprintf("%s is set by both %s (%s) and %s (%s)", setting.Key, previous.Source, previous.Value, setting.Source, setting.Value))
+			continue
+		}
+		sources[setting.Key] = setting
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting build settings:\n- %s", strings.Join(conflicts, "\n- "))
+	}
+
+	return settings, nil
+}
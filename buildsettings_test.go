@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBuildSettings(t *testing.T) {
+	input := `
+// Hardened runtime is required for notarization
+ENABLE_HARDENED_RUNTIME = YES
+OTHER_SWIFT_FLAGS=$(inherited) -DCI
+CODE_SIGN_IDENTITY[sdk=macosx*]=Developer ID Application
+EMPTY=
+`
+	want := []buildSetting{
+		{Key: "ENABLE_HARDENED_RUNTIME", Value: "YES", Source: buildSettingSourceInput},
+		{Key: "OTHER_SWIFT_FLAGS", Value: "$(inherited) -DCI", Source: buildSettingSourceInput},
+		{Key: "CODE_SIGN_IDENTITY[sdk=macosx*]", Value: "Developer ID Application", Source: buildSettingSourceInput},
+		{Key: "EMPTY", Value: "", Source: buildSettingSourceInput},
+	}
+
+	got, err := parseBuildSettings(input)
+	if err != nil {
+		t.Fatalf("parseBuildSettings() error = %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBuildSettings() = %v, want %v", got, want)
+	}
+}
+
+func TestParseBuildSettingsErrors(t *testing.T) {
+	input := "ENABLE_BITCODE\n1ST=YES\nSWIFT_VERSION=5\nSWIFT_VERSION=5.9"
+
+	_, err := parseBuildSettings(input)
+	if err == nil {
+		t.Fatalf("parseBuildSettings() expected error")
+	}
+	for _, want := range []string{
+		"line 1: missing `=`",
+		`line 2: invalid build setting name "1ST"`,
+		"line 4: SWIFT_VERSION is already set on line 3",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("parseBuildSettings() error = %s, want it to contain %s", err, want)
+		}
+	}
+}
+
+func TestXcodebuildOptionBuildSettings(t *testing.T) {
+	args := []string{"-destination", "platform=macOS", "-verbose", "SWIFT_VERSION=5", "-xcconfig", "A=B.xcconfig"}
+	want := []buildSetting{{Key: "SWIFT_VERSION", Value: "5", Source: buildSettingSourceXcodebuildOptions}}
+	if got := xcodebuildOptionBuildSettings(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("xcodebuildOptionBuildSettings() = %v, want %v", got, want)
+	}
+}
+
+func TestEffectiveBuildSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ArchiveCommandOpts
+		want    []buildSetting
+		wantErr string
+	}{
+		{
+			name: "every source",
+			opts: ArchiveCommandOpts{
+				XcodebuildOptions:         "-verbose SWIFT_VERSION=5",
+				ForceTeamID:               "TEAM",
+				DisableIndexWhileBuilding: true,
+				BuildSettings:             []buildSetting{{Key: "ENABLE_HARDENED_RUNTIME", Value: "YES", Source: buildSettingSourceInput}},
+			},
+			want: []buildSetting{
+				{Key: "SWIFT_VERSION", Value: "5", Source: buildSettingSourceXcodebuildOptions},
+				{Key: "DEVELOPMENT_TEAM", Value: "TEAM", Source: "force_team_id"},
+				{Key: "COMPILER_INDEX_STORE_ENABLE", Value: "NO", Source: "disable_index_while_building"},
+				{Key: "ENABLE_HARDENED_RUNTIME", Value: "YES", Source: buildSettingSourceInput},
+			},
+		},
+		{
+			name: "conflict with a force input",
+			opts: ArchiveCommandOpts{
+				ForceTeamID:   "TEAM",
+				BuildSettings: []buildSetting{{Key: "DEVELOPMENT_TEAM", Value: "OTHER", Source: buildSettingSourceInput}},
+			},
+			wantErr: "DEVELOPMENT_TEAM is set by both force_team_id (TEAM) and build_settings (OTHER)",
+		},
+		{
+			name: "conflict with xcodebuild_options",
+			opts: ArchiveCommandOpts{
+				XcodebuildOptions: "COMPILER_INDEX_STORE_ENABLE=YES",
+				BuildSettings:     []buildSetting{{Key: "COMPILER_INDEX_STORE_ENABLE", Value: "NO", Source: buildSettingSourceInput}},
+			},
+			wantErr: "COMPILER_INDEX_STORE_ENABLE is set by both xcodebuild_options (YES) and build_settings (NO)",
+		},
+		{
+			name:    "xcconfig set twice",
+			opts:    ArchiveCommandOpts{XcodebuildOptions: "-xcconfig Other.xcconfig", XCConfigPath: "/work/CI.xcconfig"},
+			wantErr: "both the xcconfig_path input and an -xcconfig flag",
+		},
+		{
+			name:    "invalid quoting",
+			opts:    ArchiveCommandOpts{XcodebuildOptions: `-verbose "OTHER_SWIFT_FLAGS=-DCI`},
+			wantErr: "failed to shell split xcodebuild_options",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := effectiveBuildSettings(tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("effectiveBuildSettings() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("effectiveBuildSettings() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("effectiveBuildSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
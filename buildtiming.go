@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/output"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	activityLogTargetDomainPrefix = "Xcode.IDEActivityLogDomainType.target."
+	stepTypeScriptPhase           = "PhaseScriptExecution"
+	slowestCompilationsCount      = 20
+	buildTimingSummaryCount       = 10
+)
+
+// compilationStepTypes are the build steps compiling a single source file.
+var compilationStepTypes = map[string]bool{
+	"CompileC":     true,
+	"CompileSwift": true,
+	"SwiftCompile": true,
+}
+
+// activityLogTargetTitlePattern matches the title of a target section, e.g. `Build target App of project App with configuration Release`.
+var activityLogTargetTitlePattern = regexp.MustCompile(`^\w+ target (.+?) of project `)
+
+// buildTiming is the build-timing.json artifact.
+type buildTiming struct {
+	LogPath string  `json:"logPath"`
+	Seconds float64 `json:"seconds"`
+	// Steps is the number of build steps, CachedSteps is the number of steps fetched from the compilation cache.
+	Steps               int            `json:"steps"`
+	CachedSteps         int            `json:"cachedSteps"`
+	Targets             []targetTiming `json:"targets"`
+	SlowestCompilations []stepTiming   `json:"slowestCompilations"`
+	ScriptPhases        []stepTiming   `json:"scriptPhases"`
+}
+
+// targetTiming is the duration of a target and its build steps per step type (e.g. CompileSwift, Ld).
+type targetTiming struct {
+	Name        string         `json:"name"`
+	Seconds     float64        `json:"seconds"`
+	Steps       int            `json:"steps"`
+	CachedSteps int            `json:"cachedSteps"`
+	StepTypes   []stepTypeTime `json:"stepTypes"`
+}
+
+type stepTypeTime struct {
+	Type    string  `json:"type"`
+	Count   int     `json:"count"`
+	Seconds float64 `json:"seconds"`
+}
+
+type stepTiming struct {
+	Target  string  `json:"target"`
+	Title   string  `json:"title"`
+	Seconds float64 `json:"seconds"`
+	Cached  bool    `json:"cached,omitempty"`
+}
+
+func (t buildTiming) json() (string, error) {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// newBuildTiming returns the per-target, per-step type, slowest compilation and script phase durations of the build log.
+func newBuildTiming(logPth string, root activityLogSection) buildTiming {
+	timing := buildTiming{
+		LogPath:             logPth,
+		Seconds:             seconds(root.Duration()),
+		Targets:             []targetTiming{},
+		SlowestCompilations: []stepTiming{},
+		ScriptPhases:        []stepTiming{},
+	}
+
+	var compilations []stepTiming
+	for _, target := range activityLogTargets(root) {
+		name := target.Title
+		if match := activityLogTargetTitlePattern.FindStringSubmatch(target.Title); match != nil {
+			name = match[1]
+		}
+
+		targetTime := targetTiming{Name: name, Seconds: seconds(target.Duration())}
+		stepTypes := map[string]*stepTypeTime{}
+		for _, step := range activityLogSteps(target) {
+			stepType := activityLogStepType(step)
+			stepTime := stepTiming{Target: name, Title: step.Title, Seconds: seconds(step.Duration()), Cached: step.WasFetchedFromCache}
+
+			targetTime.Steps++
+			if stepTime.Cached {
+				targetTime.CachedSteps++
+			}
+
+			if stepTypes[stepType] == nil {
+				stepTypes[stepType] = &stepTypeTime{Type: stepType}
+			}
+			stepTypes[stepType].Count++
+			stepTypes[stepType].Seconds += stepTime.Seconds
+
+			if compilationStepTypes[stepType] {
+				compilations = append(compilations, stepTime)
+			} else if stepType == stepTypeScriptPhase {
+				timing.ScriptPhases = append(timing.ScriptPhases, stepTime)
+			}
+		}
+
+		targetTime.StepTypes = []stepTypeTime{}
+		for _, stepType := range stepTypes {
+			targetTime.StepTypes = append(targetTime.StepTypes, *stepType)
+		}
+		sort.Slice(targetTime.StepTypes, func(i, j int) bool {
+			return longer(targetTime.StepTypes[i].Seconds, targetTime.StepTypes[j].Seconds, targetTime.StepTypes[i].Type, targetTime.StepTypes[j].Type)
+		})
+
+		timing.Steps += targetTime.Steps
+		timing.CachedSteps += targetTime.CachedSteps
+		timing.Targets = append(timing.Targets, targetTime)
+	}
+
+	sort.Slice(timing.Targets, func(i, j int) bool {
+		return longer(timing.Targets[i].Seconds, timing.Targets[j].Seconds, timing.Targets[i].Name, timing.Targets[j].Name)
+	})
+	sortStepTimings(compilations)
+	sortStepTimings(timing.ScriptPhases)
+
+	if len(compilations) > slowestCompilationsCount {
+		compilations = compilations[:slowestCompilationsCount]
+	}
+	timing.SlowestCompilations = append(timing.SlowestCompilations, compilations...)
+
+	return timing
+}
+
+// activityLogTargets returns the target sections of the build log.
+func activityLogTargets(section activityLogSection) []activityLogSection {
+	var targets []activityLogSection
+	for _, subsection := range section.Subsections {
+		if strings.HasPrefix(subsection.DomainType, activityLogTargetDomainPrefix) {
+			targets = append(targets, subsection)
+		} else {
+			targets = append(targets, activityLogTargets(subsection)...)
+		}
+	}
+	return targets
+}
+
+// activityLogSteps returns the build steps of a target: the leaf sections, the sections grouping steps
+// (e.g. `Compile Swift source files`) are not counted to avoid counting their time twice.
+func activityLogSteps(section activityLogSection) []activityLogSection {
+	var steps []activityLogSection
+	for _, subsection := range section.Subsections {
+		if len(subsection.Subsections) == 0 {
+			steps = append(steps, subsection)
+		} else {
+			steps = append(steps, activityLogSteps(subsection)...)
+		}
+	}
+	return steps
+}
+
+// activityLogStepType returns the type of the build step, the first word of its signature, e.g. `CompileSwift` of
+// `CompileSwift normal arm64 /work/App/AppDelegate.swift`.
+func activityLogStepType(step activityLogSection) string {
+	for _, s := range []string{step.Signature, step.Title} {
+		if fields := strings.Fields(s); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return "Other"
+}
+
+func sortStepTimings(steps []stepTiming) {
+	sort.SliceStable(steps, func(i, j int) bool {
+		return longer(steps[i].Seconds, steps[j].Seconds, steps[i].Title, steps[j].Title)
+	})
+}
+
+// longer orders by duration descending, then by name.
+func longer(a, b float64, aName, bName string) bool {
+	if a != b {
+		return a > b
+	}
+	return aName < bName
+}
+
+func seconds(d time.Duration) float64 {
+	return float64(d.Milliseconds()) / 1000
+}
+
+// exportBuildTiming analyzes the build log written since the archive started, prints the slowest targets,
+// compilations and script phases, and exports the build-timing.json.
+func exportBuildTiming(derivedDataDir string, archiveStarted time.Time, timingPth string) error {
+	logPth, err := findActivityLog(derivedDataDir, archiveStarted)
+	if err != nil {
+		return err
+	}
+	log.Printf("- build log: %s", logPth)
+
+	root, err := readActivityLog(logPth)
+	if err != nil {
+		return err
+	}
+
+	timing := newBuildTiming(logPth, root)
+	log.Printf("- duration: %.1fs, %d steps, %d fetched from cache", timing.Seconds, timing.Steps, timing.CachedSteps)
+
+	fmt.Println()
+	log.Printf("Slowest targets:")
+	for i, target := range timing.Targets {
+		if i == buildTimingSummaryCount {
+			break
+		}
+		log.Printf("%8.1fs  %s (%d steps, %d cached)", target.Seconds, target.Name, target.Steps, target.CachedSteps)
+	}
+
+	for _, steps := range []struct {
+		title string
+		steps []stepTiming
+	}{
+		{title: "Slowest compilations:", steps: timing.SlowestCompilations},
+		{title: "Slowest script phases:", steps: timing.ScriptPhases},
+	} {
+		if len(steps.steps) == 0 {
+			continue
+		}
+
+		fmt.Println()
+		log.Printf("%s", steps.title)
+		for i, step := range steps.steps {
+			if i == buildTimingSummaryCount {
+				break
+			}
+			log.Printf("%8.1fs  %s: %s", step.Seconds, step.Target, step.Title)
+		}
+	}
+	fmt.Println()
+
+	timingJSON, err := timing.json()
+	if err != nil {
+		return err
+	}
+	return output.ExportOutputFileContent(timingJSON, timingPth, bitriseBuildTimingPthEnvKey)
+}
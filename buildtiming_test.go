@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewBuildTiming(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "build.xcactivitylog")
+	writeActivityLog(t, pth, testBuildLog)
+
+	root, err := readActivityLog(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := newBuildTiming(pth, root)
+
+	want := buildTiming{
+		LogPath:     pth,
+		Seconds:     60,
+		Steps:       5,
+		CachedSteps: 1,
+		Targets: []targetTiming{
+			{
+				Name: "App", Seconds: 49.5, Steps: 4,
+				StepTypes: []stepTypeTime{
+					{Type: "CompileSwift", Count: 2, Seconds: 27.5},
+					{Type: "PhaseScriptExecution", Count: 1, Seconds: 12.25},
+					{Type: "Ld", Count: 1, Seconds: 9.5},
+				},
+			},
+			{
+				Name: "Widget", Seconds: 10, Steps: 1, CachedSteps: 1,
+				StepTypes: []stepTypeTime{{Type: "SwiftCompile", Count: 1, Seconds: 8}},
+			},
+		},
+		SlowestCompilations: []stepTiming{
+			{Target: "App", Title: "Compile AppDelegate.swift (arm64)", Seconds: 25},
+			{Target: "Widget", Title: "Compile Widget.swift (arm64)", Seconds: 8, Cached: true},
+			{Target: "App", Title: "Compile ContentView.swift (arm64)", Seconds: 2.5},
+		},
+		ScriptPhases: []stepTiming{
+			{Target: "App", Title: "Run custom shell script 'SwiftLint'", Seconds: 12.25},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newBuildTiming() = %+v, want %+v", got, want)
+	}
+}
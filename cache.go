@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	cleanPolicyAlways      = "always"
+	cleanPolicyNever       = "never"
+	cleanPolicyOnCacheMiss = "on-cache-miss"
+)
+
+// lockfileNames are the dependency lockfiles of the project directory, besides the Package.resolved of the project.
+var lockfileNames = []string{"Podfile.lock", "Cartfile.resolved"}
+
+// derivedData is the derived data directory of the archive.
+// Xcode's default derived data directory is shared by the projects, each of them builds into a `<project>-<hash>` subdirectory.
+type derivedData struct {
+	Dir    string
+	Shared bool
+}
+
+// newDerivedData returns the derived_data_path input, the -derivedDataPath of the xcodebuild options,
+// or Xcode's default derived data directory.
+func newDerivedData(derivedDataPath, xcodebuildOptions string) (derivedData, error) {
+	args, err := splitXcodebuildOptions(xcodebuildOptions)
+	if err != nil {
+		return derivedData{}, err
+	}
+	optionPath := xcodebuildFlagValue(args, "-derivedDataPath")
+
+	if derivedDataPath != "" && optionPath != "" {
+		return derivedData{}, fmt.Errorf("derived data path is set by both the derived_data_path input (%s) and xcodebuild_options (%s)", derivedDataPath, optionPath)
+	}
+	if derivedDataPath == "" {
+		derivedDataPath = optionPath
+	}
+	if derivedDataPath != "" {
+		absPath, err := filepath.Abs(derivedDataPath)
+		if err != nil {
+			return derivedData{}, err
+		}
+		return derivedData{Dir: absPath}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return derivedData{}, err
+	}
+	return derivedData{Dir: filepath.Join(homeDir, "Library", "Developer", "Xcode", "DerivedData"), Shared: true}, nil
+}
+
+// projectDir returns the directory the project builds into, or an empty string if the project has not been built yet
+// in the shared derived data directory. If there are more candidates, the last modified one is returned.
+func (d derivedData) projectDir(projectPth string) (string, error) {
+	if !d.Shared {
+		return d.Dir, nil
+	}
+
+	name := strings.ReplaceAll(strings.TrimSuffix(filepath.Base(projectPth), filepath.Ext(projectPth)), " ", "_")
+	matches, err := filepath.Glob(filepath.Join(d.Dir, name+"-*"))
+	if err != nil {
+		return "", err
+	}
+
+	newest := ""
+	var newestInfo os.FileInfo
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestInfo.ModTime()) {
+			newest, newestInfo = match, info
+		}
+	}
+	return newest, nil
+}
+
+// hasBuildProducts returns true if the derived data contains the intermediate build products of the project,
+// package resolution only writes the SourcePackages directory.
+func (d derivedData) hasBuildProducts(projectPth string) (bool, error) {
+	dir, err := d.projectDir(projectPth)
+	if err != nil || dir == "" {
+		return false, err
+	}
+	return pathutil.IsDirExists(filepath.Join(dir, "Build"))
+}
+
+// sourcePackagesDir returns the directory of the Swift package checkouts: the cloned_source_packages_path input,
+// or the SourcePackages directory of the project's derived data.
+func (d derivedData) sourcePackagesDir(projectPth, clonedSourcePackagesPath string) (string, error) {
+	if clonedSourcePackagesPath != "" {
+		return filepath.Abs(clonedSourcePackagesPath)
+	}
+
+	dir, err := d.projectDir(projectPth)
+	if err != nil || dir == "" {
+		return "", err
+	}
+	return filepath.Join(dir, "SourcePackages"), nil
+}
+
+// deprecatedCleanPolicy returns the clean policy of the deprecated is_clean_build input, or an empty string if it is not set.
+func deprecatedCleanPolicy(isCleanBuild string) (string, error) {
+	switch isCleanBuild {
+	case "":
+		return "", nil
+	case "yes":
+		return cleanPolicyAlways, nil
+	case "no":
+		return cleanPolicyNever, nil
+	}
+	return "", fmt.Errorf("invalid value (%s), expected yes or no", isCleanBuild)
+}
+
+// shouldClean returns true if the clean policy requires a clean build.
+func shouldClean(policy string, hasBuildProducts bool) bool {
+	switch policy {
+	case cleanPolicyAlways:
+		return true
+	case cleanPolicyOnCacheMiss:
+		return !hasBuildProducts
+	}
+	return false
+}
+
+// projectLockfiles returns the existing dependency lockfiles of the project.
+func projectLockfiles(projectPth string) ([]string, error) {
+	candidates := []string{packageResolvedPath(projectPth)}
+	for _, name := range lockfileNames {
+		candidates = append(candidates, filepath.Join(filepath.Dir(projectPth), name))
+	}
+
+	var lockfiles []string
+	for _, pth := range candidates {
+		if exist, err := pathutil.IsPathExists(pth); err != nil {
+			return nil, err
+		} else if exist {
+			lockfiles = append(lockfiles, pth)
+		}
+	}
+	return lockfiles, nil
+}
+
+// buildCacheKey returns the key of the build cache, it changes with the Xcode version, the scheme, the configuration
+// and the content of the lockfiles.
+func buildCacheKey(xcodeVersion, scheme, configuration string, lockfiles []string) (string, error) {
+	lines := []string{
+		"xcode: " + xcodeVersion,
+		"scheme: " + scheme,
+		"configuration: " + configuration,
+	}
+
+	var lockfileLines []string
+	for _, pth := range lockfiles {
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			return "", err
+		}
+		lockfileLines = append(lockfileLines, fmt.Sprintf("%s: %x", filepath.Base(pth), sha256.Sum256(content)))
+	}
+	sort.Strings(lockfileLines)
+
+	sum := sha256.Sum256([]byte(strings.Join(append(lines, lockfileLines...), "\n")))
+	return fmt.Sprintf("xcode-archive-%x", sum), nil
+}
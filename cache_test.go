@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDerivedData(t *testing.T) {
+	got, err := newDerivedData("", `-derivedDataPath "/tmp/Derived Data" -verbose`)
+	if err != nil {
+		t.Fatalf("newDerivedData() error = %s", err)
+	}
+	if want := (derivedData{Dir: "/tmp/Derived Data"}); got != want {
+		t.Errorf("newDerivedData() = %+v, want %+v", got, want)
+	}
+
+	got, err = newDerivedData("/cache/DerivedData", "")
+	if err != nil {
+		t.Fatalf("newDerivedData() error = %s", err)
+	}
+	if want := (derivedData{Dir: "/cache/DerivedData"}); got != want {
+		t.Errorf("newDerivedData() = %+v, want %+v", got, want)
+	}
+
+	got, err = newDerivedData("", "")
+	if err != nil {
+		t.Fatalf("newDerivedData() error = %s", err)
+	}
+	if filepath.Base(got.Dir) != "DerivedData" || !got.Shared {
+		t.Errorf("newDerivedData() = %+v, want Xcode's shared DerivedData directory", got)
+	}
+
+	_, err = newDerivedData("/cache/DerivedData", "-derivedDataPath /tmp/DerivedData")
+	if err == nil || !strings.Contains(err.Error(), "both the derived_data_path input") {
+		t.Errorf("newDerivedData() error = %v, want a conflict error", err)
+	}
+}
+
+func TestDerivedDataProjectDir(t *testing.T) {
+	dir := t.TempDir()
+	shared := derivedData{Dir: dir, Shared: true}
+
+	if got, err := shared.projectDir("/work/My App.xcodeproj"); err != nil || got != "" {
+		t.Errorf("projectDir() = %s, %v, want no directory before the first build", got, err)
+	}
+	if hasBuildProducts, err := shared.hasBuildProducts("/work/My App.xcodeproj"); err != nil || hasBuildProducts {
+		t.Errorf("hasBuildProducts() = %t, %v, want false before the first build", hasBuildProducts, err)
+	}
+
+	oldDir := filepath.Join(dir, "My_App-abc")
+	newDir := filepath.Join(dir, "My_App-def")
+	writeFile(t, filepath.Join(oldDir, "Build", "Intermediates.noindex", "info"), "")
+	writeFile(t, filepath.Join(newDir, "SourcePackages", "workspace-state.json"), "{}")
+	writeFile(t, filepath.Join(dir, "Other-abc", "Build", "info"), "")
+	if err := os.Chtimes(oldDir, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := shared.projectDir("/work/My App.xcodeproj")
+	if err != nil {
+		t.Fatalf("projectDir() error = %s", err)
+	}
+	if got != newDir {
+		t.Errorf("projectDir() = %s, want %s", got, newDir)
+	}
+
+	if hasBuildProducts, err := shared.hasBuildProducts("/work/My App.xcodeproj"); err != nil || hasBuildProducts {
+		t.Errorf("hasBuildProducts() = %t, %v, want false for a derived data with resolved packages only", hasBuildProducts, err)
+	}
+	if hasBuildProducts, err := (derivedData{Dir: oldDir}).hasBuildProducts("/work/My App.xcodeproj"); err != nil || !hasBuildProducts {
+		t.Errorf("hasBuildProducts() = %t, %v, want true", hasBuildProducts, err)
+	}
+
+	packagesDir, err := shared.sourcePackagesDir("/work/My App.xcodeproj", "")
+	if err != nil {
+		t.Fatalf("sourcePackagesDir() error = %s", err)
+	}
+	if want := filepath.Join(newDir, "SourcePackages"); packagesDir != want {
+		t.Errorf("sourcePackagesDir() = %s, want %s", packagesDir, want)
+	}
+	if packagesDir, err := shared.sourcePackagesDir("/work/My App.xcodeproj", "/cache/spm"); err != nil || packagesDir != "/cache/spm" {
+		t.Errorf("sourcePackagesDir() = %s, %v, want /cache/spm", packagesDir, err)
+	}
+}
+
+func TestShouldClean(t *testing.T) {
+	tests := []struct {
+		policy           string
+		hasBuildProducts bool
+		want             bool
+	}{
+		{policy: cleanPolicyAlways, hasBuildProducts: true, want: true},
+		{policy: cleanPolicyNever, hasBuildProducts: false, want: false},
+		{policy: cleanPolicyOnCacheMiss, hasBuildProducts: false, want: true},
+		{policy: cleanPolicyOnCacheMiss, hasBuildProducts: true, want: false},
+	}
+	for _, tt := range tests {
+		if got := shouldClean(tt.policy, tt.hasBuildProducts); got != tt.want {
+			t.Errorf("shouldClean(%s, %t) = %t, want %t", tt.policy, tt.hasBuildProducts, got, tt.want)
+		}
+	}
+}
+
+func TestDeprecatedCleanPolicy(t *testing.T) {
+	for isCleanBuild, want := range map[string]string{"": "", "yes": cleanPolicyAlways, "no": cleanPolicyNever} {
+		if got, err := deprecatedCleanPolicy(isCleanBuild); err != nil || got != want {
+			t.Errorf("deprecatedCleanPolicy(%q) = %s, %v, want %s", isCleanBuild, got, err, want)
+		}
+	}
+	if _, err := deprecatedCleanPolicy("true"); err == nil {
+		t.Errorf("deprecatedCleanPolicy(true) error = nil, want an error")
+	}
+}
+
+func TestBuildCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	projectPth := filepath.Join(dir, "App.xcodeproj")
+	writeFile(t, packageResolvedPath(projectPth), `{"pins": [], "version": 2}`)
+	writeFile(t, filepath.Join(dir, "Podfile.lock"), "PODS:\n  - Sparkle (2.5.0)\n")
+
+	lockfiles, err := projectLockfiles(projectPth)
+	if err != nil {
+		t.Fatalf("projectLockfiles() error = %s", err)
+	}
+	if len(lockfiles) != 2 {
+		t.Fatalf("projectLockfiles() = %v, want Package.resolved and Podfile.lock", lockfiles)
+	}
+
+	key, err := buildCacheKey("15.0", "App", "Release", lockfiles)
+	if err != nil {
+		t.Fatalf("buildCacheKey() error = %s", err)
+	}
+	if !strings.HasPrefix(key, "xcode-archive-") {
+		t.Errorf("buildCacheKey() = %s, want an xcode-archive- prefix", key)
+	}
+	if again, _ := buildCacheKey("15.0", "App", "Release", []string{lockfiles[1], lockfiles[0]}); again != key {
+		t.Errorf("buildCacheKey() = %s, want %s regardless of the lockfile order", again, key)
+	}
+
+	for _, changed := range []func() (string, error){
+		func() (string, error) { return buildCacheKey("15.1", "App", "Release", lockfiles) },
+		func() (string, error) { return buildCacheKey("15.0", "App", "Debug", lockfiles) },
+		func() (string, error) {
+			writeFile(t, filepath.Join(dir, "Podfile.lock"), "PODS:\n  - Sparkle (2.6.0)\n")
+			return buildCacheKey("15.0", "App", "Release", lockfiles)
+		},
+	} {
+		if other, err := changed(); err != nil || other == key {
+			t.Errorf("buildCacheKey() = %s, %v, want a different key", other, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+// skippedProjectSearchDirs are the directories of dependency managers and build tools,
+// their projects are never the one to archive.
+var skippedProjectSearchDirs = map[string]bool{
+	".git":     true,
+	".build":   true,
+	"Pods":     true,
+	"Carthage": true,
+}
+
+// findProjectCandidates returns the workspaces and projects in the directory tree.
+// Workspaces embedded in a project are not returned, as the walk does not descend into the bundles.
+func findProjectCandidates(dir string) (workspaces, projects []string, err error) {
+	err = filepath.WalkDir(dir, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		switch {
+		case skippedProjectSearchDirs[d.Name()]:
+			return filepath.SkipDir
+		case filepath.Ext(pth) == ".xcworkspace":
+			workspaces = append(workspaces, pth)
+			return filepath.SkipDir
+		case filepath.Ext(pth) == ".xcodeproj":
+			projects = append(projects, pth)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(workspaces)
+	sort.Strings(projects)
+	return workspaces, projects, nil
+}
+
+// detectProject returns the only workspace in the directory tree, or the only project if there is no workspace.
+func detectProject(dir string) (string, error) {
+	workspaces, projects, err := findProjectCandidates(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to search for projects in %s: %s", dir, err)
+	}
+
+	candidates := workspaces
+	if len(candidates) == 0 {
+		candidates = projects
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no .xcworkspace or .xcodeproj found in %s", dir)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("found multiple candidates in %s, set the project_path input to one of them:\n- %s", dir, strings.Join(candidates, "\n- "))
+	}
+}
+
+// detectScheme returns the only shared scheme of the project or workspace archiving a macOS app.
+func detectScheme(projectPth string) (string, error) {
+	containers, err := schemeContainers(projectPth)
+	if err != nil {
+		return "", err
+	}
+
+	var sharedNames, candidates []string
+	seen := map[string]bool{}
+	for _, container := range containers {
+		schemes, err := xcodeSchemes(container)
+		if err != nil {
+			return "", err
+		}
+
+		for _, scheme := range schemes {
+			if !scheme.IsShared || seen[scheme.Name] {
+				continue
+			}
+			seen[scheme.Name] = true
+			sharedNames = append(sharedNames, scheme.Name)
+
+			if archivesMacOSApp(scheme) {
+				candidates = append(candidates, scheme.Name)
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if len(sharedNames) == 0 {
+			return "", fmt.Errorf("no shared scheme found in %s", projectPth)
+		}
+		return "", fmt.Errorf("none of the shared schemes archives a macOS app, set the scheme input to one of them:\n- %s", strings.Join(sharedNames, "\n- "))
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("found multiple shared schemes archiving a macOS app, set the scheme input to one of them:\n- %s", strings.Join(candidates, "\n- "))
+	}
+}
+
+// archivesMacOSApp returns true if the scheme's Archive action builds a macOS application target.
+func archivesMacOSApp(scheme xcodeScheme) bool {
+	if !scheme.HasArchiveAction() {
+		return false
+	}
+
+	configuration := scheme.ArchiveAction.BuildConfiguration
+	baseDir := filepath.Dir(scheme.ContainerPath)
+	for _, reference := range scheme.ArchivableReferences() {
+		project, err := openXcodeProject(reference.ContainerPath(baseDir))
+		if err != nil {
+			continue
+		}
+
+		target, ok := project.Target(reference.BlueprintIdentifier)
+		if ok && target.IsApplication() && buildsForMacOS(target, configuration) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildsForMacOS returns true if the target's SDKROOT is macosx, or auto (a multiplatform target) with macosx
+// among the SUPPORTED_PLATFORMS.
+func buildsForMacOS(target xcodeTarget, configuration string) bool {
+	switch target.BuildSetting(configuration, "SDKROOT") {
+	case "macosx":
+		return true
+	case "auto":
+		return sliceutil.IsStringInSlice("macosx", strings.Fields(target.BuildSetting(configuration, "SUPPORTED_PLATFORMS")))
+	}
+	return false
+}
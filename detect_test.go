@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-xcode/xcodeproject/serialized"
+)
+
+func createDirs(t *testing.T, root string, dirs ...string) {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindProjectCandidates(t *testing.T) {
+	root := t.TempDir()
+	createDirs(t, root,
+		"App.xcodeproj/project.xcworkspace",
+		"App.xcworkspace",
+		"Pods/Pods.xcodeproj",
+		"Carthage/Checkouts/Lib/Lib.xcodeproj",
+		".build/checkouts/Package/Package.xcodeproj",
+		"Modules/Core/Core.xcodeproj",
+	)
+
+	workspaces, projects, err := findProjectCandidates(root)
+	if err != nil {
+		t.Fatalf("findProjectCandidates() error = %s", err)
+	}
+
+	if want := []string{filepath.Join(root, "App.xcworkspace")}; !reflect.DeepEqual(workspaces, want) {
+		t.Errorf("workspaces = %v, want %v", workspaces, want)
+	}
+	wantProjects := []string{filepath.Join(root, "App.xcodeproj"), filepath.Join(root, "Modules/Core/Core.xcodeproj")}
+	if !reflect.DeepEqual(projects, wantProjects) {
+		t.Errorf("projects = %v, want %v", projects, wantProjects)
+	}
+}
+
+func TestDetectProject(t *testing.T) {
+	root := t.TempDir()
+	createDirs(t, root, "App.xcodeproj", "App.xcworkspace")
+
+	got, err := detectProject(root)
+	if err != nil {
+		t.Fatalf("detectProject() error = %s", err)
+	}
+	if want := filepath.Join(root, "App.xcworkspace"); got != want {
+		t.Errorf("detectProject() = %v, want %v", got, want)
+	}
+
+	createDirs(t, root, "Other/Other.xcworkspace")
+	if _, err := detectProject(root); err == nil || !strings.Contains(err.Error(), "Other.xcworkspace") {
+		t.Errorf("detectProject() error = %v, want the candidates listed", err)
+	}
+
+	if _, err := detectProject(t.TempDir()); err == nil {
+		t.Errorf("detectProject() expected error for an empty directory")
+	}
+}
+
+func TestDetectScheme(t *testing.T) {
+	for _, projectPth := range []string{"testdata/App.xcodeproj", "testdata/App.xcworkspace"} {
+		got, err := detectScheme(projectPth)
+		if err != nil {
+			t.Fatalf("detectScheme(%s) error = %s", projectPth, err)
+		}
+		if got != "App" {
+			t.Errorf("detectScheme(%s) = %v, want App", projectPth, got)
+		}
+	}
+}
+
+func TestBuildsForMacOS(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings serialized.Object
+		want     bool
+	}{
+		{name: "macOS", settings: serialized.Object{"SDKROOT": "macosx"}, want: true},
+		{name: "iOS", settings: serialized.Object{"SDKROOT": "iphoneos"}, want: false},
+		{name: "multiplatform", settings: serialized.Object{"SDKROOT": "auto", "SUPPORTED_PLATFORMS": "iphoneos iphonesimulator macosx"}, want: true},
+		{name: "multiplatform without macOS", settings: serialized.Object{"SDKROOT": "auto", "SUPPORTED_PLATFORMS": "iphoneos iphonesimulator"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := xcodeTarget{Name: "App", BuildSettings: map[string]serialized.Object{"Release": tt.settings}}
+			if got := buildsForMacOS(target, "Release"); got != tt.want {
+				t.Errorf("buildsForMacOS() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
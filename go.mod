@@ -6,15 +6,16 @@ require (
 	github.com/bitrise-io/go-steputils v1.0.5
 	github.com/bitrise-io/go-utils v1.0.9
 	github.com/bitrise-io/go-xcode v1.0.16
+	github.com/hashicorp/go-version v1.6.0
 	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51
+	github.com/ryanuber/go-glob v1.0.0
+	golang.org/x/sys v0.13.0
+	howett.net/plist v1.0.0
 )
 
 require (
 	github.com/bitrise-io/go-pkcs12 v0.0.0-20230815095624-feb898696e02 // indirect
 	github.com/fullsailor/pkcs7 v0.0.0-20190404230743-d7302db945fa // indirect
-	github.com/hashicorp/go-version v1.6.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/ryanuber/go-glob v1.0.0 // indirect
 	golang.org/x/crypto v0.12.0 // indirect
-	howett.net/plist v1.0.0 // indirect
 )
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-xcode/xcarchive"
+)
+
+// macOSReleaseSymbols maps macOS versions to the symbols used by Homebrew's `depends_on macos:` stanza.
+var macOSReleaseSymbols = []struct {
+	major, minor int
+	symbol       string
+}{
+	{15, 0, "sequoia"},
+	{14, 0, "sonoma"},
+	{13, 0, "ventura"},
+	{12, 0, "monterey"},
+	{11, 0, "big_sur"},
+	{10, 15, "catalina"},
+	{10, 14, "mojave"},
+	{10, 13, "high_sierra"},
+	{10, 12, "sierra"},
+	{10, 11, "el_capitan"},
+	{10, 10, "yosemite"},
+}
+
+// homebrewCask holds the data of a Homebrew cask manifest.
+type homebrewCask struct {
+	Token            string
+	Version          string
+	SHA256           string
+	URL              string
+	Name             string
+	Homepage         string
+	MinimumMacOS     string
+	AppBundleName    string
+	BundleIdentifier string
+}
+
+// String renders the cask as a Ruby cask definition.
+func (cask homebrewCask) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "cask %s do\n", rubyString(cask.Token))
+	fmt.Fprintf(&b, "  version %s\n", rubyString(cask.Version))
+	fmt.Fprintf(&b, "  sha256 %s\n", rubyString(cask.SHA256))
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "  url %s\n", rubyString(cask.URL))
+	fmt.Fprintf(&b, "  name %s\n", rubyString(cask.Name))
+	if cask.Homepage != "" {
+		fmt.Fprintf(&b, "  homepage %s\n", rubyString(cask.Homepage))
+	}
+
+	if symbol := homebrewMacOSSymbol(cask.MinimumMacOS); symbol != "" {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "  depends_on macos: \">= :%s\"\n", symbol)
+	}
+
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "  app %s\n", rubyString(cask.AppBundleName))
+
+	if cask.BundleIdentifier != "" {
+		b.WriteString("\n")
+		b.WriteString("  zap trash: [\n")
+		for _, pth := range homebrewZapPaths(cask.BundleIdentifier) {
+			fmt.Fprintf(&b, "    %s,\n", rubyString(pth))
+		}
+		b.WriteString("  ]\n")
+	}
+
+	b.WriteString("end\n")
+
+	return b.String()
+}
+
+// rubyString quotes the value as a Ruby double quoted string literal.
+// The `#{version}` interpolation is kept, every other interpolation sequence is escaped.
+func rubyString(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "#{", `\#{`).Replace(value)
+	escaped = strings.ReplaceAll(escaped, `\#{version}`, "#{version}")
+	return `"` + escaped + `"`
+}
+
+// homebrewMacOSSymbol returns the Homebrew symbol of the newest macOS release not newer than the given minimum system version.
+func homebrewMacOSSymbol(minimumSystemVersion string) string {
+	if minimumSystemVersion == "" {
+		return ""
+	}
+
+	components := strings.Split(minimumSystemVersion, ".")
+	major, err := strconv.Atoi(components[0])
+	if err != nil {
+		return ""
+	}
+	minor := 0
+	if len(components) > 1 {
+		if minor, err = strconv.Atoi(components[1]); err != nil {
+			return ""
+		}
+	}
+
+	for _, release := range macOSReleaseSymbols {
+		if major > release.major || (major == release.major && minor >= release.minor) {
+			return release.symbol
+		}
+	}
+	return ""
+}
+
+func homebrewZapPaths(bundleID string) []string {
+	return []string{
+		"~/Library/Application Support/" + bundleID,
+		"~/Library/Caches/" + bundleID,
+		"~/Library/Containers/" + bundleID,
+		"~/Library/HTTPStorages/" + bundleID,
+		"~/Library/Preferences/" + bundleID + ".plist",
+		"~/Library/Saved Application State/" + bundleID + ".savedState",
+	}
+}
+
+var nonTokenCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// tokenPattern is Homebrew's cask token format: lowercase letters, digits, `-`, `@` and `.`, starting with a letter or digit.
+var tokenPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9@.-]*$`)
+
+// validateHomebrewCaskToken checks the cask token, it is also the file name of the cask.
+func validateHomebrewCaskToken(token string) error {
+	if !tokenPattern.MatchString(token) {
+		return fmt.Errorf("invalid Homebrew cask token (%s): use lowercase letters, digits, '-', '@' and '.'", token)
+	}
+	return nil
+}
+
+// homebrewCaskToken converts the app name to a cask token, following Homebrew's token naming rules.
+func homebrewCaskToken(appName string) string {
+	token := strings.ToLower(appName)
+	token = strings.ReplaceAll(token, "+", "-plus-")
+	token = strings.ReplaceAll(token, "@", "-at-")
+	token = nonTokenCharacters.ReplaceAllString(token, "-")
+	return strings.Trim(token, "-")
+}
+
+// newHomebrewCask creates a cask manifest for the exported artifact of the archive.
+func newHomebrewCask(archive xcarchive.MacosArchive, artifactPth, token, urlTemplate, homepage string) (homebrewCask, error) {
+	infoPlist := archive.Application.InfoPlist
+
+	version, _ := infoPlist.GetString("CFBundleShortVersionString")
+	if version == "" {
+		return homebrewCask{}, fmt.Errorf("CFBundleShortVersionString not found in the app's Info.plist")
+	}
+	build, _ := infoPlist.GetString("CFBundleVersion")
+	minimumSystemVersion, _ := infoPlist.GetString("LSMinimumSystemVersion")
+
+	checksum, err := fileSHA256(artifactPth)
+	if err != nil {
+		return homebrewCask{}, err
+	}
+
+	name := appNameFromArchive(archive)
+	if token == "" {
+		token = homebrewCaskToken(name)
+	}
+	if err := validateHomebrewCaskToken(token); err != nil {
+		return homebrewCask{}, err
+	}
+
+	return homebrewCask{
+		Token:            token,
+		Version:          version,
+		SHA256:           checksum,
+		URL:              expandArtifactURLTemplate(urlTemplate, "#{version}", build, filepath.Base(artifactPth)),
+		Name:             name,
+		Homepage:         homepage,
+		MinimumMacOS:     minimumSystemVersion,
+		AppBundleName:    filepath.Base(archive.Application.Path),
+		BundleIdentifier: archive.Application.BundleIdentifier(),
+	}, nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file's content.
+func fileSHA256(pth string) (string, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %s", pth, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", pth, err)
+		}
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %s", pth, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHomebrewMacOSSymbol(t *testing.T) {
+	tests := map[string]string{
+		"":        "",
+		"10.9":    "",
+		"10.13":   "high_sierra",
+		"10.15.4": "catalina",
+		"11.0":    "big_sur",
+		"12":      "monterey",
+		"13.5":    "ventura",
+		"16.0":    "sequoia",
+		"abc":     "",
+	}
+	for version, want := range tests {
+		if got := homebrewMacOSSymbol(version); got != want {
+			t.Errorf("homebrewMacOSSymbol(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestHomebrewCaskToken(t *testing.T) {
+	tests := map[string]string{
+		"My App":      "my-app",
+		"Foo+":        "foo-plus",
+		"App (Beta) ": "app-beta",
+		"X@Home":      "x-at-home",
+	}
+	for name, want := range tests {
+		if got := homebrewCaskToken(name); got != want {
+			t.Errorf("homebrewCaskToken(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestValidateHomebrewCaskToken(t *testing.T) {
+	for _, token := range []string{"my-app", "font-0xproto", "openssl@3", "visual-studio-code.app"} {
+		if err := validateHomebrewCaskToken(token); err != nil {
+			t.Errorf("validateHomebrewCaskToken(%q) error = %s", token, err)
+		}
+	}
+	for _, token := range []string{"", "..", "../../etc/profile", "my/app", "My App", "-app"} {
+		if err := validateHomebrewCaskToken(token); err == nil {
+			t.Errorf("validateHomebrewCaskToken(%q) error = nil, want an error", token)
+		}
+	}
+}
+
+func TestHomebrewCaskString(t *testing.T) {
+	cask := homebrewCask{
+		Token:            "my-app",
+		Version:          "1.2.0",
+		SHA256:           "abc",
+		URL:              "https://example.com/#{version}/My App.app.zip",
+		Name:             "My \"App\"",
+		MinimumMacOS:     "11.0",
+		AppBundleName:    "My App.app",
+		BundleIdentifier: "io.bitrise.app",
+	}
+
+	want := `cask "my-app" do
+  version "1.2.0"
+  sha256 "abc"
+
+  url "https://example.com/#{version}/My App.app.zip"
+  name "My \"App\""
+
+  depends_on macos: ">= :big_sur"
+
+  app "My App.app"
+
+  zap trash: [
+    "~/Library/Application Support/io.bitrise.app",
+    "~/Library/Caches/io.bitrise.app",
+    "~/Library/Containers/io.bitrise.app",
+    "~/Library/HTTPStorages/io.bitrise.app",
+    "~/Library/Preferences/io.bitrise.app.plist",
+    "~/Library/Saved Application State/io.bitrise.app.savedState",
+  ]
+end
+`
+	if got := cask.String(); got != want {
+		t.Errorf("homebrewCask.String() = %v, want %v", got, want)
+	}
+}
+
+func TestFileSHA256(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(pth, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fileSHA256(pth)
+	if err != nil {
+		t.Fatalf("fileSHA256() error = %s", err)
+	}
+	if want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; got != want {
+		t.Errorf("fileSHA256() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-io/go-utils/sliceutil"
+	"github.com/bitrise-io/go-xcode/plistutil"
+)
+
+const (
+	icnsMagic        = "icns"
+	icnsHeaderLength = 8
+)
+
+var (
+	pngSignature      = []byte("\x89PNG\r\n\x1a\n")
+	jpeg2000Signature = []byte("\x00\x00\x00\x0cjP  \r\n\x87\n")
+	pngEndChunk       = []byte("IEND\xae\x42\x60\x82")
+)
+
+// icnsElementSizes are the pixel sizes of the PNG/JPEG 2000 and ARGB elements of an icns container.
+// The legacy RGB and mask elements (is32, s8mk, ...) are not used, every modern icon has a larger representation.
+var icnsElementSizes = map[string]int{
+	"icp4": 16,
+	"icp5": 32,
+	"icp6": 64,
+	"ic07": 128,
+	"ic08": 256,
+	"ic09": 512,
+	"ic10": 1024,
+	"ic11": 32,
+	"ic12": 64,
+	"ic13": 256,
+	"ic14": 512,
+	"ic04": 16,
+	"ic05": 32,
+}
+
+type iconFormat string
+
+const (
+	iconFormatPNG      iconFormat = "png"
+	iconFormatJPEG2000 iconFormat = "jpeg2000"
+	iconFormatARGB     iconFormat = "argb"
+)
+
+// iconFormatPreference orders the representations of the same size, PNG is exported as it is.
+var iconFormatPreference = map[iconFormat]int{iconFormatPNG: 0, iconFormatARGB: 1, iconFormatJPEG2000: 2}
+
+// iconRepresentation is an image of an icns container.
+type iconRepresentation struct {
+	Type   string
+	Format iconFormat
+	Size   int
+	Data   []byte
+}
+
+// appIcon is the extracted app icon.
+type appIcon struct {
+	// Source is the icns or Assets.car file the icon was extracted from.
+	Source string
+	Size   int
+	PNG    []byte
+}
+
+// parseICNS returns the PNG, JPEG 2000 and ARGB representations of an icns container, largest first.
+func parseICNS(content []byte) ([]iconRepresentation, error) {
+	if len(content) < icnsHeaderLength || string(content[:4]) != icnsMagic {
+		return nil, fmt.Errorf("not an icns file")
+	}
+	length := int(binary.BigEndian.Uint32(content[4:8]))
+	if length > len(content) {
+		return nil, fmt.Errorf("icns length (%d) exceeds the file size (%d)", length, len(content))
+	}
+
+	var representations []iconRepresentation
+	for offset := icnsHeaderLength; offset+icnsHeaderLength <= length; {
+		elementType := string(content[offset : offset+4])
+		elementLength := int(binary.BigEndian.Uint32(content[offset+4 : offset+8]))
+		if elementLength < icnsHeaderLength || offset+elementLength > length {
+			return nil, fmt.Errorf("invalid length (%d) of icns element %s", elementLength, elementType)
+		}
+		data := content[offset+icnsHeaderLength : offset+elementLength]
+		offset += elementLength
+
+		size, ok := icnsElementSizes[elementType]
+		if !ok {
+			continue
+		}
+
+		representation := iconRepresentation{Type: elementType, Size: size, Data: data}
+		switch {
+		case bytes.HasPrefix(data, pngSignature):
+			representation.Format = iconFormatPNG
+			if config, err := png.DecodeConfig(bytes.NewReader(data)); err == nil {
+				representation.Size = config.Width
+			}
+		case bytes.HasPrefix(data, jpeg2000Signature):
+			representation.Format = iconFormatJPEG2000
+		case bytes.HasPrefix(data, []byte("ARGB")):
+			representation.Format = iconFormatARGB
+		default:
+			continue
+		}
+		representations = append(representations, representation)
+	}
+
+	sortIconRepresentations(representations)
+	return representations, nil
+}
+
+func sortIconRepresentations(representations []iconRepresentation) {
+	sort.SliceStable(representations, func(i, j int) bool {
+		if representations[i].Size != representations[j].Size {
+			return representations[i].Size > representations[j].Size
+		}
+		return iconFormatPreference[representations[i].Format] < iconFormatPreference[representations[j].Format]
+	})
+}
+
+// decodeARGB decodes an ARGB element: the alpha, red, green and blue channels one after the other,
+// each compressed with the icns run-length encoding.
+func decodeARGB(data []byte, size int) (image.Image, error) {
+	if !bytes.HasPrefix(data, []byte("ARGB")) {
+		return nil, fmt.Errorf("missing ARGB header")
+	}
+
+	pixels := size * size
+	channels, err := decodeICNSRunLength(data[4:], 4*pixels)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := 0; i < pixels; i++ {
+		img.SetNRGBA(i%size, i/size, color.NRGBA{
+			A: channels[i],
+			R: channels[pixels+i],
+			G: channels[2*pixels+i],
+			B: channels[3*pixels+i],
+		})
+	}
+	return img, nil
+}
+
+// decodeICNSRunLength decodes the icns run-length encoding: a header byte below 0x80 is followed by header+1 literal bytes,
+// a header byte from 0x80 is followed by a single byte repeated header-125 times.
+func decodeICNSRunLength(data []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+	for i := 0; i < len(data) && len(out) < length; {
+		header := int(data[i])
+		i++
+
+		if header < 0x80 {
+			count := header + 1
+			if i+count > len(data) {
+				return nil, fmt.Errorf("truncated run-length data")
+			}
+			out = append(out, data[i:i+count]...)
+			i += count
+			continue
+		}
+
+		if i >= len(data) {
+			return nil, fmt.Errorf("truncated run-length data")
+		}
+		for count := header - 125; count > 0; count-- {
+			out = append(out, data[i])
+		}
+		i++
+	}
+
+	if len(out) < length {
+		return nil, fmt.Errorf("run-length data decoded to %d bytes, expected %d", len(out), length)
+	}
+	return out[:length], nil
+}
+
+// iconPNG returns the representation as PNG.
+func iconPNG(representation iconRepresentation) ([]byte, error) {
+	switch representation.Format {
+	case iconFormatPNG:
+		return representation.Data, nil
+	case iconFormatJPEG2000:
+		return convertJPEG2000ToPNG(representation.Data)
+	case iconFormatARGB:
+		img, err := decodeARGB(representation.Data, representation.Size)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown icon format: %s", representation.Format)
+}
+
+// largestIconPNG returns the largest representation which can be converted to PNG.
+func largestIconPNG(representations []iconRepresentation) (int, []byte, error) {
+	var errs []string
+	for _, representation := range representations {
+		content, err := iconPNG(representation)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s (%dpx %s): %s", representation.Type, representation.Size, representation.Format, err))
+			continue
+		}
+		return representation.Size, content, nil
+	}
+	if len(errs) > 0 {
+		return 0, nil, fmt.Errorf("no representation could be converted to PNG:\n- %s", strings.Join(errs, "\n- "))
+	}
+	return 0, nil, fmt.Errorf("no PNG, JPEG 2000 or ARGB representation")
+}
+
+// appIconCandidates returns the icns files of the app referenced by CFBundleIconFile and CFBundleIconName.
+// actool writes an icns next to the Assets.car for the app icon set named by CFBundleIconName.
+func appIconCandidates(appPath string, infoPlist plistutil.PlistData) []string {
+	resourcesDir := filepath.Join(appPath, "Contents", "Resources")
+
+	var candidates []string
+	for _, key := range []string{"CFBundleIconFile", "CFBundleIconName"} {
+		name, ok := infoPlist.GetString(key)
+		if !ok || name == "" {
+			continue
+		}
+		if filepath.Ext(name) != ".icns" {
+			name += ".icns"
+		}
+		pth := filepath.Join(resourcesDir, name)
+		if !sliceutil.IsStringInSlice(pth, candidates) {
+			candidates = append(candidates, pth)
+		}
+	}
+	return candidates
+}
+
+// extractAppIcon extracts the app icon of an .app (from an xcarchive or exported) as PNG.
+// The icns referenced by the Info.plist is used; if the app only has an asset catalog (Assets.car),
+// the largest PNG or icns stored uncompressed in it is used.
+func extractAppIcon(appPath string, infoPlist plistutil.PlistData) (appIcon, error) {
+	var errs []string
+	for _, pth := range appIconCandidates(appPath, infoPlist) {
+		if exist, err := pathutil.IsPathExists(pth); err != nil {
+			return appIcon{}, err
+		} else if !exist {
+			continue
+		}
+
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			return appIcon{}, err
+		}
+		representations, err := parseICNS(content)
+		if err == nil {
+			var size int
+			var iconContent []byte
+			if size, iconContent, err = largestIconPNG(representations); err == nil {
+				return appIcon{Source: pth, Size: size, PNG: iconContent}, nil
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", pth, err))
+	}
+
+	assetCatalogPth := filepath.Join(appPath, "Contents", "Resources", "Assets.car")
+	if exist, err := pathutil.IsPathExists(assetCatalogPth); err != nil {
+		return appIcon{}, err
+	} else if exist {
+		content, err := os.ReadFile(assetCatalogPth)
+		if err != nil {
+			return appIcon{}, err
+		}
+		size, iconContent, err := largestIconPNG(assetCatalogIconRepresentations(content))
+		if err == nil {
+			return appIcon{Source: assetCatalogPth, Size: size, PNG: iconContent}, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s, the asset catalog renditions are likely compressed", assetCatalogPth, err))
+	}
+
+	if len(errs) == 0 {
+		return appIcon{}, fmt.Errorf("the app has no icns file and no asset catalog")
+	}
+	return appIcon{}, fmt.Errorf("failed to extract the app icon:\n- %s", strings.Join(errs, "\n- "))
+}
+
+// assetCatalogIconRepresentations returns the icns containers and PNG images stored uncompressed in a compiled asset catalog.
+// The Assets.car format is undocumented, the renditions are found by their signatures, largest first.
+func assetCatalogIconRepresentations(content []byte) []iconRepresentation {
+	var representations []iconRepresentation
+
+	for offset := 0; ; {
+		idx := bytes.Index(content[offset:], []byte(icnsMagic))
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		offset = start + len(icnsMagic)
+
+		if start+icnsHeaderLength > len(content) {
+			break
+		}
+		length := int(binary.BigEndian.Uint32(content[start+4 : start+8]))
+		if length <= icnsHeaderLength || start+length > len(content) {
+			continue
+		}
+		if icns, err := parseICNS(content[start : start+length]); err == nil {
+			representations = append(representations, icns...)
+		}
+	}
+
+	for offset := 0; ; {
+		idx := bytes.Index(content[offset:], pngSignature)
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		offset = start + len(pngSignature)
+
+		end := bytes.Index(content[start:], pngEndChunk)
+		if end < 0 {
+			break
+		}
+		data := content[start : start+end+len(pngEndChunk)]
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil || config.Width != config.Height {
+			continue
+		}
+		representations = append(representations, iconRepresentation{Type: "Assets.car", Format: iconFormatPNG, Size: config.Width, Data: data})
+	}
+
+	sortIconRepresentations(representations)
+	return representations
+}
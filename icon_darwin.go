@@ -0,0 +1,37 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// convertJPEG2000ToPNG converts a JPEG 2000 image to PNG using the sips tool.
+func convertJPEG2000ToPNG(data []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "icon")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warnf("Failed to remove (%s), error: %s", dir, err)
+		}
+	}()
+
+	src := filepath.Join(dir, "icon.jp2")
+	dst := filepath.Join(dir, "icon.png")
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := command.New("sips", "-s", "format", "png", src, "--out", dst)
+	if out, err := cmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %s", cmd.PrintableCommandArgs(), out)
+	}
+	return os.ReadFile(dst)
+}
@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package main
+
+import "fmt"
+
+// convertJPEG2000ToPNG is not supported on non macOS systems, there is no JPEG 2000 decoder to rely on.
+func convertJPEG2000ToPNG([]byte) ([]byte, error) {
+	return nil, fmt.Errorf("JPEG 2000 is only supported on macOS")
+}
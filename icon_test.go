@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-xcode/plistutil"
+)
+
+func testPNG(t *testing.T, size int, c color.NRGBA) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testARGB returns an ARGB element of a single color, every channel is a run of repeated bytes.
+func testARGB(size int, c color.NRGBA) []byte {
+	data := []byte("ARGB")
+	for _, value := range []byte{c.A, c.R, c.G, c.B} {
+		for remaining := size * size; remaining > 0; {
+			count := remaining
+			if count > 130 {
+				count = 130
+			}
+			data = append(data, byte(count+125), value)
+			remaining -= count
+		}
+	}
+	return data
+}
+
+func testICNS(elements map[string][]byte, order []string) []byte {
+	var body []byte
+	for _, elementType := range order {
+		header := make([]byte, icnsHeaderLength)
+		copy(header, elementType)
+		binary.BigEndian.PutUint32(header[4:], uint32(icnsHeaderLength+len(elements[elementType])))
+		body = append(append(body, header...), elements[elementType]...)
+	}
+
+	header := make([]byte, icnsHeaderLength)
+	copy(header, icnsMagic)
+	binary.BigEndian.PutUint32(header[4:], uint32(icnsHeaderLength+len(body)))
+	return append(header, body...)
+}
+
+func TestParseICNS(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	content := testICNS(map[string][]byte{
+		"ic04": testARGB(16, red),
+		"ic11": testPNG(t, 32, red),
+		"ic09": append(append([]byte{}, jpeg2000Signature...), 0x00),
+		"s8mk": make([]byte, 256),
+		"TOC ": make([]byte, 8),
+	}, []string{"TOC ", "ic04", "s8mk", "ic11", "ic09"})
+
+	representations, err := parseICNS(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range representations {
+		got = append(got, r.Type+" "+string(r.Format))
+	}
+	if want := []string{"ic09 jpeg2000", "ic11 png", "ic04 argb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseICNS() = %v, want %v", got, want)
+	}
+
+	if _, err := parseICNS([]byte("not an icon")); err == nil || !strings.Contains(err.Error(), "not an icns file") {
+		t.Errorf("parseICNS() error = %v, want not an icns file", err)
+	}
+}
+
+func TestDecodeARGB(t *testing.T) {
+	c := color.NRGBA{R: 10, G: 20, B: 30, A: 128}
+	img, err := decodeARGB(testARGB(16, c), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Dx(); got != 16 {
+		t.Errorf("width = %d, want 16", got)
+	}
+	if got := img.(*image.NRGBA).NRGBAAt(15, 15); got != c {
+		t.Errorf("pixel = %v, want %v", got, c)
+	}
+
+	if _, err := decodeARGB([]byte("ARGB\x00\x01"), 16); err == nil || !strings.Contains(err.Error(), "expected 1024") {
+		t.Errorf("decodeARGB() error = %v, want a truncated data error", err)
+	}
+}
+
+func TestExtractAppIcon(t *testing.T) {
+	blue := color.NRGBA{B: 255, A: 255}
+	largest := testPNG(t, 64, blue)
+
+	newApp := func(t *testing.T, files map[string][]byte) string {
+		appPath := filepath.Join(t.TempDir(), "Sample.app")
+		resourcesDir := filepath.Join(appPath, "Contents", "Resources")
+		if err := os.MkdirAll(resourcesDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(resourcesDir, name), content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return appPath
+	}
+
+	t.Run("icns referenced by CFBundleIconFile", func(t *testing.T) {
+		appPath := newApp(t, map[string][]byte{
+			"AppIcon.icns": testICNS(map[string][]byte{
+				"ic05": testARGB(32, blue),
+				"icp6": largest,
+			}, []string{"ic05", "icp6"}),
+		})
+
+		icon, err := extractAppIcon(appPath, plistutil.PlistData{"CFBundleIconFile": "AppIcon"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if icon.Size != 64 || !bytes.Equal(icon.PNG, largest) {
+			t.Errorf("extractAppIcon() = %dpx icon, want the 64px PNG", icon.Size)
+		}
+		if want := filepath.Join(appPath, "Contents", "Resources", "AppIcon.icns"); icon.Source != want {
+			t.Errorf("Source = %s, want %s", icon.Source, want)
+		}
+	})
+
+	t.Run("ARGB only icns", func(t *testing.T) {
+		appPath := newApp(t, map[string][]byte{
+			"AppIcon.icns": testICNS(map[string][]byte{"ic05": testARGB(32, blue)}, []string{"ic05"}),
+		})
+
+		icon, err := extractAppIcon(appPath, plistutil.PlistData{"CFBundleIconName": "AppIcon"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(icon.PNG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 32 {
+			t.Errorf("width = %d, want 32", img.Bounds().Dx())
+		}
+	})
+
+	t.Run("asset catalog fallback", func(t *testing.T) {
+		car := append([]byte("BOMStore\x00\x00junk"), testPNG(t, 16, blue)...)
+		car = append(car, []byte("CTSI\x00\x01")...)
+		car = append(car, largest...)
+		car = append(car, []byte("trailing")...)
+		appPath := newApp(t, map[string][]byte{"Assets.car": car})
+
+		icon, err := extractAppIcon(appPath, plistutil.PlistData{"CFBundleIconName": "AppIcon"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if icon.Size != 64 || !bytes.Equal(icon.PNG, largest) {
+			t.Errorf("extractAppIcon() = %dpx icon, want the 64px PNG", icon.Size)
+		}
+	})
+
+	t.Run("compressed asset catalog", func(t *testing.T) {
+		appPath := newApp(t, map[string][]byte{"Assets.car": []byte("BOMStore\x00\x00CELM compressed")})
+
+		_, err := extractAppIcon(appPath, plistutil.PlistData{"CFBundleIconName": "AppIcon"})
+		if err == nil || !strings.Contains(err.Error(), "Assets.car") {
+			t.Errorf("extractAppIcon() error = %v, want an asset catalog error", err)
+		}
+	})
+
+	t.Run("no icon", func(t *testing.T) {
+		appPath := newApp(t, nil)
+
+		_, err := extractAppIcon(appPath, plistutil.PlistData{})
+		if err == nil || !strings.Contains(err.Error(), "no icns file and no asset catalog") {
+			t.Errorf("extractAppIcon() error = %v, want no icon error", err)
+		}
+	})
+}
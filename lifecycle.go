@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const signalGracePeriod = 30 * time.Second
+
+// stepLifecycle is the lifecycle of the Step run, failf and the end of main exit through it.
+var stepLifecycle = newLifecycle(os.Exit)
+
+// lifecycle tracks the resources of the Step run: the temporary directories, the process groups of the running commands
+// and the hooks flushing partial logs and reports. On exit it runs the hooks, stops the running process groups
+// and removes the temporary directories, whatever the exit path is.
+type lifecycle struct {
+	mu            sync.Mutex
+	tempDirs      []string
+	kept          map[string]bool
+	processGroups map[int]bool
+	exitHooks     []func(failure *stepError)
+
+	// stateMu guards the state of the Step read by the exit hooks, see locked.
+	stateMu sync.Mutex
+
+	interrupted atomic.Bool
+	exitOnce    sync.Once
+	exitFunc    func(code int)
+}
+
+func newLifecycle(exitFunc func(code int)) *lifecycle {
+	return &lifecycle{
+		kept:          map[string]bool{},
+		processGroups: map[int]bool{},
+		exitFunc:      exitFunc,
+	}
+}
+
+// tempDir creates a temporary directory, it is removed on exit unless it is kept.
+func (l *lifecycle) tempDir(prefix string) (string, error) {
+	dir, err := pathutil.NormalizedOSTempDirPath(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tempDirs = append(l.tempDirs, dir)
+	return dir, nil
+}
+
+// keep excludes a temporary directory from the clean-up, if it holds an exported output.
+func (l *lifecycle) keep(dir string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.kept[dir] = true
+}
+
+// addProcessGroup registers the process group of a running command, the signals received by the Step are forwarded to it.
+func (l *lifecycle) addProcessGroup(pgid int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.processGroups[pgid] = true
+}
+
+func (l *lifecycle) removeProcessGroup(pgid int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.processGroups, pgid)
+}
+
+// onExit registers a hook to run on exit with the failure of the Step (nil on success), the hooks run in reverse order
+// of registration.
+// A hook must not exit, failures are logged as warnings.
+func (l *lifecycle) onExit(hook func(failure *stepError)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exitHooks = append(l.exitHooks, hook)
+}
+
+// locked runs fn holding the state lock. The exit hooks may run on the signal handling goroutine while main is running,
+// the state they share with main is only accessed in locked functions. fn must not exit.
+func (l *lifecycle) locked(fn func()) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	fn()
+}
+
+// signal sends the signal to the registered process groups and returns their number.
+func (l *lifecycle) signal(sig syscall.Signal) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for pgid := range l.processGroups {
+		if err := syscall.Kill(-pgid, sig); err != nil {
+			log.Warnf("Failed to send %s to process group %d, error: %s", sig, pgid, err)
+		}
+	}
+	return len(l.processGroups)
+}
+
+// isInterrupted returns true if the Step received a signal, the failing commands must not be retried.
+func (l *lifecycle) isInterrupted() bool {
+	return l.interrupted.Load()
+}
+
+// exit runs the exit hooks, terminates the running process groups, removes the temporary directories and exits
+// with the exit code of the failure category, or 0 if failure is nil.
+// Concurrent calls wait for the first one, which exits the process.
+func (l *lifecycle) exit(failure *stepError) {
+	l.exitOnce.Do(func() {
+		l.mu.Lock()
+		hooks := append([]func(*stepError){}, l.exitHooks...)
+		l.mu.Unlock()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i](failure)
+		}
+
+		if running := l.signal(syscall.SIGTERM); running > 0 {
+			log.Warnf("Terminated %d running process group(s)", running)
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, dir := range l.tempDirs {
+			if l.kept[dir] {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				log.Warnf("Failed to remove temporary directory (%s), error: %s", dir, err)
+			}
+		}
+	})
+	code := 0
+	if failure != nil {
+		code = failure.Category.exitCode()
+	}
+	l.exitFunc(code)
+}
+
+// handleSignals forwards SIGINT and SIGTERM to the running process groups, which run in their own process group
+// and so do not receive the signals of the terminal or of the CI agent. The failing command fails the Step the usual
+// way; if no command is running, or the Step does not exit within the grace period, the Step exits on its own.
+func (l *lifecycle) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+			sysSig := sig.(syscall.Signal)
+			l.interrupted.Store(true)
+			log.Warnf("Received %s, stopping the Step ...", sig)
+
+			if l.signal(sysSig) == 0 {
+				log.Errorf("Interrupted by %s", sig)
+				l.exit(newStepError(failureInterrupted, "Interrupted by %s", sig))
+			}
+
+			go func() {
+				time.Sleep(signalGracePeriod)
+				log.Errorf("Interrupted by %s, the running commands did not stop in %s", sysSig, signalGracePeriod)
+				l.exit(newStepError(failureInterrupted, "Interrupted by %s, the running commands did not stop in %s", sysSig, signalGracePeriod))
+			}()
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLifecycleExit(t *testing.T) {
+	var exitCodes []int
+	l := newLifecycle(func(code int) { exitCodes = append(exitCodes, code) })
+
+	tempDir, err := l.tempDir("lifecycle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptDir, err := l.tempDir("lifecycle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(keptDir); err != nil {
+			t.Error(err)
+		}
+	}()
+	l.keep(keptDir)
+
+	var hooks []string
+	l.onExit(func(failure *stepError) { hooks = append(hooks, "report") })
+	l.onExit(func(failure *stepError) {
+		if failure != nil {
+			hooks = append(hooks, "raw log")
+		}
+	})
+
+	failure := newStepError(failureArchive, "Archive failed")
+	l.exit(failure)
+	l.exit(failure)
+
+	if want := []string{"raw log", "report"}; !reflect.DeepEqual(hooks, want) {
+		t.Errorf("hooks = %v, want %v run once in reverse order", hooks, want)
+	}
+	if want := []int{12, 12}; !reflect.DeepEqual(exitCodes, want) {
+		t.Errorf("exit codes = %v, want %v", exitCodes, want)
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("temporary directory %s exists after exit", tempDir)
+	}
+	if _, err := os.Stat(keptDir); err != nil {
+		t.Errorf("kept directory %s was removed: %s", keptDir, err)
+	}
+}
+
+func TestLifecycleSignal(t *testing.T) {
+	l := newLifecycle(func(int) {})
+
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	l.addProcessGroup(cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	if got := l.signal(syscall.SIGINT); got != 1 {
+		t.Errorf("signal() = %d, want 1 process group", got)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected the process to be interrupted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the process did not receive the signal")
+	}
+
+	l.removeProcessGroup(cmd.Process.Pid)
+	if got := l.signal(syscall.SIGINT); got != 0 {
+		t.Errorf("signal() = %d, want no process group", got)
+	}
+}
+
+func TestLifecycleSignalWhileAddingArtifacts(t *testing.T) {
+	exited := make(chan int, 1)
+	l := newLifecycle(func(code int) {
+		select {
+		case exited <- code:
+		default:
+		}
+	})
+
+	dir := t.TempDir()
+	var pths []string
+	for i := 0; i < 3; i++ {
+		pth := filepath.Join(dir, fmt.Sprintf("artifact-%d", i))
+		if err := os.WriteFile(pth, []byte(pth), 0600); err != nil {
+			t.Fatal(err)
+		}
+		pths = append(pths, pth)
+	}
+
+	var artifacts artifactIndex
+	var indexed []artifact
+	l.onExit(func(*stepError) {
+		l.locked(func() {
+			indexed = append([]artifact{}, artifacts.Artifacts...)
+		})
+	})
+
+	stop := make(chan struct{})
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			l.locked(func() {
+				if err := artifacts.add(pths[i%len(pths)], ""); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}()
+
+	l.handleSignals()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-exited:
+		if code != failureInterrupted.exitCode() {
+			t.Errorf("exit code = %d, want %d", code, failureInterrupted.exitCode())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the Step did not exit on the signal")
+	}
+	close(stop)
+	<-added
+
+	if !l.isInterrupted() {
+		t.Errorf("expected the Step to be interrupted")
+	}
+	if len(indexed) > len(pths) {
+		t.Errorf("indexed %d artifacts, want at most %d", len(indexed), len(pths))
+	}
+}
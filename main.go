@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitrise-io/go-steputils/output"
 	"github.com/bitrise-io/go-steputils/stepconf"
@@ -26,7 +30,6 @@ import (
 	"github.com/bitrise-io/go-xcode/xcarchive"
 	"github.com/bitrise-io/go-xcode/xcodebuild"
 	"github.com/bitrise-io/go-xcode/xcpretty"
-	"github.com/kballard/go-shellquote"
 )
 
 const (
@@ -37,6 +40,26 @@ const (
 	bitriseXCArchiveDirPthEnvKey        = "BITRISE_MACOS_XCARCHIVE_PATH"
 	bitriseAppPthEnvKey                 = "BITRISE_APP_PATH"
 	bitriseIDEDistributionLogsPthEnvKey = "BITRISE_IDEDISTRIBUTION_LOGS_PATH"
+	bitriseSparkleAppcastPthEnvKey      = "BITRISE_SPARKLE_APPCAST_PATH"
+	bitriseHomebrewCaskPthEnvKey        = "BITRISE_HOMEBREW_CASK_PATH"
+	bitriseArtifactsIndexPthEnvKey      = "BITRISE_ARTIFACTS_INDEX_PATH"
+	bitriseSHA256SumsPthEnvKey          = "BITRISE_SHA256SUMS_PATH"
+	bitriseProvenancePthEnvKey          = "BITRISE_PROVENANCE_PATH"
+	bitriseDetectedProjectPathEnvKey    = "BITRISE_MACOS_ARCHIVE_PROJECT_PATH"
+	bitriseDetectedSchemeEnvKey         = "BITRISE_MACOS_ARCHIVE_SCHEME"
+	bitriseResolvedPackagesPthEnvKey    = "BITRISE_RESOLVED_PACKAGES_PATH"
+	bitriseSBOMPthEnvKey                = "BITRISE_SBOM_PATH"
+	bitriseArchiveReportPthEnvKey       = "BITRISE_ARCHIVE_REPORT_PATH"
+	bitriseXCResultZipPthEnvKey         = "BITRISE_XCRESULT_ZIP_PATH"
+	bitriseBuildTimingPthEnvKey         = "BITRISE_BUILD_TIMING_PATH"
+	bitriseDerivedDataPathEnvKey        = "BITRISE_DERIVED_DATA_PATH"
+	bitriseSPMCachePathEnvKey           = "BITRISE_SPM_CACHE_PATH"
+	bitriseBuildCacheKeyEnvKey          = "BITRISE_BUILD_CACHE_KEY"
+	bitriseXcodebuildRetryCountEnvKey   = "BITRISE_XCODEBUILD_RETRY_COUNT"
+	bitriseStepResultPthEnvKey          = "BITRISE_STEP_RESULT_PATH"
+	bitriseStepMetricsPthEnvKey         = "BITRISE_STEP_METRICS_PATH"
+	bitriseBuildSummaryPthEnvKey        = "BITRISE_BUILD_SUMMARY_PATH"
+	bitriseAppIconPthEnvKey             = "BITRISE_APP_ICON_PATH"
 )
 
 // config ...
@@ -45,12 +68,30 @@ type config struct {
 	CustomExportOptionsPlistContent string `env:"custom_export_options_plist_content"`
 
 	XcodebuildOptions         string `env:"xcodebuild_options"`
-	ProjectPath               string `env:"project_path,dir"`
-	Scheme                    string `env:"scheme,required"`
+	BuildSettings             string `env:"build_settings"`
+	XCConfigPath              string `env:"xcconfig_path"`
+	BuildNumber               string `env:"build_number"`
+	BuildNumberOffset         int    `env:"build_number_offset"`
+	MarketingVersion          string `env:"marketing_version"`
+	ProjectPath               string `env:"project_path"`
+	Scheme                    string `env:"scheme"`
 	Configuration             string `env:"configuration"`
-	IsCleanBuild              string `env:"is_clean_build,opt[yes,no]"`
+	CleanPolicy               string `env:"clean_policy,opt[always,never,on-cache-miss]"`
+	IsCleanBuild              string `env:"is_clean_build"`
+	DerivedDataPath           string `env:"derived_data_path"`
+	IsRunPreflight            string `env:"is_run_preflight,opt[yes,no]"`
 	WorkDir                   string `env:"workdir"`
+	XcodeVersion              string `env:"xcode_version"`
+	DeveloperDir              string `env:"developer_dir"`
 	DisableIndexWhileBuilding bool   `env:"disable_index_while_building,opt[yes,no]"`
+	XcodebuildTimeout         int    `env:"xcodebuild_timeout,range[0..1440]"`
+	XcodebuildOutputTimeout   int    `env:"xcodebuild_output_timeout,range[0..1440]"`
+	XcodebuildRetries         int    `env:"xcodebuild_retries,range[0..5]"`
+	TransientFailurePatterns  string `env:"transient_failure_patterns"`
+
+	ClonedSourcePackagesPath  string `env:"cloned_source_packages_path"`
+	PackageResolutionRetries  int    `env:"package_resolution_retries,range[0..10]"`
+	IsStrictPackageResolution string `env:"is_strict_package_resolution,opt[yes,no]"`
 
 	ForceTeamID                       string `env:"force_team_id"`
 	ForceCodeSignIdentity             string `env:"force_code_sign_identity"`
@@ -58,16 +99,59 @@ type config struct {
 	ForceProvisioningProfile          string `env:"force_provisioning_profile"`
 
 	OutputTool           string `env:"output_tool,opt[xcpretty,xcodebuild]"`
-	OutputDir            string `env:"output_dir,dir"`
-	ArtifactName         string `env:"artifact_name,required"`
+	OutputDir            string `env:"output_dir"`
+	ArtifactName         string `env:"artifact_name"`
 	IsExportXcarchiveZip string `env:"is_export_xcarchive_zip,opt[yes,no]"`
 	IsExportAllDsyms     string `env:"is_export_all_dsyms,opt[yes,no]"`
+	IsGenerateSBOM       string `env:"is_generate_sbom,opt[yes,no]"`
+	IsGenerateTiming     string `env:"is_generate_build_timing,opt[yes,no]"`
 	VerboseLog           string `env:"verbose_log"`
+
+	IsGenerateSparkleAppcast   string          `env:"is_generate_sparkle_appcast,opt[yes,no]"`
+	SparkleEdPrivateKey        stepconf.Secret `env:"sparkle_ed_private_key"`
+	SparkleDownloadURLTemplate string          `env:"sparkle_download_url_template"`
+	SparkleReleaseNotesURL     string          `env:"sparkle_release_notes_url"`
+	SparkleAppcastPath         string          `env:"sparkle_appcast_path"`
+
+	IsGenerateHomebrewCask  string `env:"is_generate_homebrew_cask,opt[yes,no]"`
+	HomebrewCaskURLTemplate string `env:"homebrew_cask_url_template"`
+	HomebrewCaskToken       string `env:"homebrew_cask_token"`
+	HomebrewCaskHomepage    string `env:"homebrew_cask_homepage"`
+
+	ZipCompressionLevel int    `env:"zip_compression_level,range[0..9]"`
+	IsZipPreserveXattrs string `env:"is_zip_preserve_xattrs,opt[yes,no]"`
+
+	IsGenerateProvenance string          `env:"is_generate_provenance,opt[yes,no]"`
+	ProvenanceSigningKey stepconf.Secret `env:"provenance_signing_key"`
+}
+
+func failf(category failureCategory, format string, v ...interface{}) {
+	fail(newStepError(category, format, v...))
 }
 
-func failf(format string, v ...interface{}) {
-	log.Errorf(format, v...)
-	os.Exit(1)
+func fail(failure *stepError) {
+	log.Errorf("%s", failure.Message)
+	stepLifecycle.exit(failure)
+}
+
+// enterWorkDir changes the current directory to the working directory and returns its absolute path.
+// The commands spawned by the Step inherit the current directory.
+func enterWorkDir(workDir string) (string, error) {
+	absWorkDir, err := pathutil.AbsPath(workDir)
+	if err != nil {
+		return "", err
+	}
+
+	if exist, err := pathutil.IsDirExists(absWorkDir); err != nil {
+		return "", err
+	} else if !exist {
+		return "", fmt.Errorf("directory does not exist")
+	}
+
+	if err := os.Chdir(absWorkDir); err != nil {
+		return "", err
+	}
+	return absWorkDir, nil
 }
 
 func findIDEDistrubutionLogsPath(output string) (string, error) {
@@ -88,6 +172,16 @@ func findIDEDistrubutionLogsPath(output string) (string, error) {
 	return "", nil
 }
 
+// appNameFromArchive returns the display name of the archived app, falling back to the .app bundle's name.
+func appNameFromArchive(archive xcarchive.MacosArchive) string {
+	for _, key := range []string{"CFBundleDisplayName", "CFBundleName"} {
+		if name, ok := archive.Application.InfoPlist.GetString(key); ok && name != "" {
+			return name
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(archive.Application.Path), ".app")
+}
+
 func macCodeSignGroup(archive xcarchive.MacosArchive, installedCertificates []certificateutil.CertificateInfoModel,
 	installedInstallerCertificates []certificateutil.CertificateInfoModel, installedProfiles []profileutil.ProvisioningProfileInfoModel,
 	exportMethod exportoptions.Method, cfg config) (*export.MacCodeSignGroup, error) {
@@ -168,24 +262,223 @@ func macCodeSignGroup(archive xcarchive.MacosArchive, installedCertificates []ce
 }
 
 func main() {
+	startTime := time.Now()
+	stepLifecycle.handleSignals()
+
 	var cfg config
+
+	// The exit hooks may run on the signal handling goroutine, the state they read is accessed with stepLifecycle.locked.
+	// outputDir is the output_dir input, it is set once the inputs are parsed.
+	var outputDir string
+
+	// The artifact index and SHA256SUMS are written on every exit path, after the other exit hooks exported
+	// the step result, the step metrics and the build summary.
+	var artifacts artifactIndex
+	addArtifact := func(pth, envKey string) {
+		stepLifecycle.locked(func() {
+			if err := artifacts.add(pth, envKey); err != nil {
+				log.Warnf("Failed to add %s to the artifact index, error: %s", pth, err)
+			}
+		})
+	}
+	// indexedArtifacts returns a copy of the artifacts indexed so far.
+	indexedArtifacts := func() []artifact {
+		var copied []artifact
+		stepLifecycle.locked(func() {
+			copied = append(copied, artifacts.Artifacts...)
+		})
+		return copied
+	}
+	stepLifecycle.onExit(func(*stepError) {
+		var outputDirAtExit string
+		stepLifecycle.locked(func() {
+			outputDirAtExit = outputDir
+		})
+		if outputDirAtExit == "" {
+			return
+		}
+		index := artifactIndex{Artifacts: indexedArtifacts()}
+
+		fmt.Println()
+		log.Infof("Writing artifact index ...")
+		fmt.Println()
+
+		fmt.Print(index.sha256Sums(outputDirAtExit))
+		fmt.Println()
+
+		artifactsIndexPath := filepath.Join(outputDirAtExit, artifactsIndexFileName)
+		if indexJSON, err := index.json(); err != nil {
+			log.Warnf("Failed to encode artifact index, error: %s", err)
+		} else if err := output.ExportOutputFileContent(indexJSON, artifactsIndexPath, bitriseArtifactsIndexPthEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseArtifactsIndexPthEnvKey, err)
+		} else {
+			log.Donef("The artifact index path is now available in the Environment Variable: %s (value: %s)", bitriseArtifactsIndexPthEnvKey, artifactsIndexPath)
+		}
+
+		sha256SumsPath := filepath.Join(outputDirAtExit, sha256SumsFileName)
+		if err := output.ExportOutputFileContent(index.sha256Sums(outputDirAtExit), sha256SumsPath, bitriseSHA256SumsPthEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseSHA256SumsPthEnvKey, err)
+		} else {
+			log.Donef("The SHA256SUMS path is now available in the Environment Variable: %s (value: %s)", bitriseSHA256SumsPthEnvKey, sha256SumsPath)
+		}
+	})
+
+	// The step-result.json summarizes the outcome for the wrapper workflows, it is written on every exit path.
+	// The log pointers are set once the output paths are known.
+	var logPointers map[string]string
+	stepLifecycle.onExit(func(failure *stepError) {
+		var outputDirAtExit string
+		var logs map[string]string
+		stepLifecycle.locked(func() {
+			outputDirAtExit, logs = outputDir, logPointers
+		})
+		if outputDirAtExit == "" {
+			return
+		}
+
+		stepResultPath := filepath.Join(outputDirAtExit, stepResultFileName)
+		if result, err := newStepResult(failure, logs); err != nil {
+			log.Warnf("Failed to collect the logs of the step result, error: %s", err)
+		} else if err := exportStepResult(result, stepResultPath); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseStepResultPthEnvKey, err)
+		} else {
+			log.Donef("The step result path is now available in the Environment Variable: %s (value: %s)", bitriseStepResultPthEnvKey, stepResultPath)
+			addArtifact(stepResultPath, bitriseStepResultPthEnvKey)
+		}
+	})
+
 	if err := stepconf.Parse(&cfg); err != nil {
-		failf("Issue with input: %s", err)
+		failf(failureInput, "Issue with input: %s", err)
 	}
 
 	stepconf.Print(cfg)
 	fmt.Println()
+	stepLifecycle.locked(func() {
+		outputDir = cfg.OutputDir
+	})
 	log.SetEnableDebugLog(cfg.VerboseLog == "yes")
 
+	// Deprecated is_clean_build input, it overrides the clean policy if set
+	if policy, err := deprecatedCleanPolicy(cfg.IsCleanBuild); err != nil {
+		failf(failureInput, "Issue with input is_clean_build: %s", err)
+	} else if policy != "" {
+		log.Warnf("The is_clean_build input is deprecated, use clean_policy: %s instead", policy)
+		cfg.CleanPolicy = policy
+	}
+
+	// The provenance is generated at the end of the Step, an invalid signing key should not waste the build
+	var provenanceSigningKey ed25519.PrivateKey
+	if cfg.IsGenerateProvenance == "yes" {
+		privateKey, err := parseEd25519PrivateKey(string(cfg.ProvenanceSigningKey))
+		if err != nil {
+			failf(failureInput, "Failed to parse provenance signing key, error: %s", err)
+		}
+		provenanceSigningKey = privateKey
+	}
+
+	// The appcast is generated at the end of the Step, invalid Sparkle inputs should not waste the build
+	var sparklePrivateKey ed25519.PrivateKey
+	if cfg.IsGenerateSparkleAppcast == "yes" {
+		if err := validateSparkleDownloadURLTemplate(cfg.SparkleDownloadURLTemplate); err != nil {
+			failf(failureInput, "Issue with input sparkle_download_url_template: %s", err)
+		}
+
+		privateKey, err := parseSparklePrivateKey(string(cfg.SparkleEdPrivateKey))
+		if err != nil {
+			failf(failureInput, "Failed to parse Sparkle EdDSA private key, error: %s", err)
+		}
+		sparklePrivateKey = privateKey
+	}
+
+	// Working directory, the relative path inputs are resolved against it and the commands run in it
+	if cfg.WorkDir != "" {
+		absWorkDir, err := enterWorkDir(cfg.WorkDir)
+		if err != nil {
+			failf(failureInput, "Failed to enter the working directory (%s), error: %s", cfg.WorkDir, err)
+		}
+		cfg.WorkDir = absWorkDir
+	}
+
+	// Project and scheme detection
+	if cfg.ProjectPath == "" || cfg.Scheme == "" {
+		log.Infof("Detecting project and scheme ...")
+		fmt.Println()
+
+		if cfg.ProjectPath == "" {
+			projectPath, err := detectProject(".")
+			if err != nil {
+				failf(failureInput, "Failed to detect the project, error: %s", err)
+			}
+			cfg.ProjectPath = projectPath
+
+			if err := tools.ExportEnvironmentWithEnvman(bitriseDetectedProjectPathEnvKey, cfg.ProjectPath); err != nil {
+				failf(failureOutput, "Failed to export %s, error: %s", bitriseDetectedProjectPathEnvKey, err)
+			}
+			log.Donef("The detected project path is now available in the Environment Variable: %s (value: %s)", bitriseDetectedProjectPathEnvKey, cfg.ProjectPath)
+		}
+
+		if cfg.Scheme == "" {
+			scheme, err := detectScheme(cfg.ProjectPath)
+			if err != nil {
+				failf(failureInput, "Failed to detect the scheme, error: %s", err)
+			}
+			cfg.Scheme = scheme
+
+			if err := tools.ExportEnvironmentWithEnvman(bitriseDetectedSchemeEnvKey, cfg.Scheme); err != nil {
+				failf(failureOutput, "Failed to export %s, error: %s", bitriseDetectedSchemeEnvKey, err)
+			}
+			log.Donef("The detected scheme is now available in the Environment Variable: %s (value: %s)", bitriseDetectedSchemeEnvKey, cfg.Scheme)
+		}
+		fmt.Println()
+	}
+
+	absProjectPath, err := pathutil.AbsPath(cfg.ProjectPath)
+	if err != nil {
+		failf(failureInput, "Failed to expand project path (%s), error: %s", cfg.ProjectPath, err)
+	}
+	cfg.ProjectPath = absProjectPath
+
+	if exist, err := pathutil.IsDirExists(cfg.ProjectPath); err != nil {
+		failf(failureInput, "Failed to check if project (%s) exists, error: %s", cfg.ProjectPath, err)
+	} else if !exist {
+		failf(failureInput, "Project (%s) does not exist", cfg.ProjectPath)
+	}
+
+	if cfg.ArtifactName == "" {
+		cfg.ArtifactName = cfg.Scheme
+	}
+
 	log.Infof("step determined cfg:")
 
+	// Select Xcode
+	if cfg.XcodeVersion != "" || cfg.DeveloperDir != "" {
+		var installations []xcodeInstallation
+		if cfg.DeveloperDir == "" {
+			if installations, err = findXcodeInstallations(xcodeSearchPattern); err != nil {
+				failf(failurePreflight, "Failed to search for Xcode installations, error: %s", err)
+			}
+		}
+
+		xcode, err := selectXcode(cfg.XcodeVersion, cfg.DeveloperDir, installations)
+		if err != nil {
+			failf(failurePreflight, "Failed to select Xcode: %s", err)
+		}
+
+		// Every xcodebuild and xcrun call of the Step inherits DEVELOPER_DIR.
+		if err := os.Setenv("DEVELOPER_DIR", xcode.DeveloperDir()); err != nil {
+			failf(failurePreflight, "Failed to set DEVELOPER_DIR, error: %s", err)
+		}
+		log.Printf("- xcode: %s", xcode)
+	}
+
 	// Detect Xcode major version
 	xcodebuildVersion, err := utility.GetXcodeVersion()
 	if err != nil {
-		failf("Failed to get the version of xcodebuild! Error: %s", err)
+		failf(failurePreflight, "Failed to get the version of xcodebuild! Error: %s", err)
 	}
 	log.Printf("- xcodebuild_version: %s (%s)", xcodebuildVersion.Version, xcodebuildVersion.BuildVersion)
 
+	xcprettySetupStarted := time.Now()
 	outputTool := cfg.OutputTool
 	if outputTool == "xcpretty" {
 		fmt.Println()
@@ -230,24 +523,24 @@ func main() {
 		}
 		log.Printf("- xcprettyVersion: %s", xcprettyVersion.String())
 	}
-
-	// Validation CustomExportOptionsPlistContent
-	if cfg.CustomExportOptionsPlistContent != "" &&
-		xcodebuildVersion.MajorVersion < 7 {
-		log.Warnf("CustomExportOptionsPlistContent is set, but CustomExportOptionsPlistContent only used if xcodeMajorVersion > 6")
-		cfg.CustomExportOptionsPlistContent = ""
-	}
-
-	if cfg.ForceProvisioningProfileSpecifier != "" &&
-		xcodebuildVersion.MajorVersion < 8 {
-		log.Warnf("ForceProvisioningProfileSpecifier is set, but ForceProvisioningProfileSpecifier only used if xcodeMajorVersion > 7")
-		cfg.ForceProvisioningProfileSpecifier = ""
+	if cfg.OutputTool == "xcpretty" {
+		stepMetrics.measure(phaseXcprettySetup, xcprettySetupStarted)
 	}
 
-	if cfg.ForceTeamID == "" &&
-		xcodebuildVersion.MajorVersion < 8 {
-		log.Warnf("ForceTeamID is set, but ForceTeamID only used if xcodeMajorVersion > 7")
-		cfg.ForceTeamID = ""
+	// Validate the inputs relying on Xcode capabilities
+	for _, input := range []struct {
+		name       string
+		value      *string
+		capability xcodeCapability
+	}{
+		{name: "CustomExportOptionsPlistContent", value: &cfg.CustomExportOptionsPlistContent, capability: xcodeCapabilityExportOptionsPlist},
+		{name: "ForceProvisioningProfileSpecifier", value: &cfg.ForceProvisioningProfileSpecifier, capability: xcodeCapabilityProvisioningProfileSpecifier},
+		{name: "ForceTeamID", value: &cfg.ForceTeamID, capability: xcodeCapabilityDevelopmentTeam},
+	} {
+		if *input.value != "" && !xcodeSupports(xcodebuildVersion.MajorVersion, input.capability) {
+			log.Warnf("%s is set, but it is only used if xcodeMajorVersion >= %d (%s)", input.name, xcodeCapabilities[input.capability], input.capability)
+			*input.value = ""
+		}
 	}
 
 	if cfg.ForceProvisioningProfileSpecifier != "" &&
@@ -256,6 +549,102 @@ func main() {
 		cfg.ForceProvisioningProfile = ""
 	}
 
+	watchdog := watchdogOpts{
+		Timeout:       time.Duration(cfg.XcodebuildTimeout) * time.Minute,
+		OutputTimeout: time.Duration(cfg.XcodebuildOutputTimeout) * time.Minute,
+		GracePeriod:   watchdogGracePeriod,
+	}
+
+	transientSignatures, err := parseTransientSignatures(cfg.TransientFailurePatterns)
+	if err != nil {
+		failf(failureInput, "Issue with input: %s", err)
+	}
+	retry := retryPolicy{
+		Retries:    cfg.XcodebuildRetries,
+		Signatures: append(append([]transientSignature{}, defaultTransientSignatures...), transientSignatures...),
+		Backoff:    retryInitialBackoff,
+		Sleep:      time.Sleep,
+	}
+
+	// The retries of the package resolution, archive and export, exported on every exit path.
+	retryCount := 0
+	addRetries := func(retries int) {
+		stepLifecycle.locked(func() {
+			retryCount += retries
+		})
+	}
+	stepLifecycle.onExit(func(*stepError) {
+		var retries int
+		stepLifecycle.locked(func() {
+			retries = retryCount
+		})
+		if err := tools.ExportEnvironmentWithEnvman(bitriseXcodebuildRetryCountEnvKey, strconv.Itoa(retries)); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseXcodebuildRetryCountEnvKey, err)
+		}
+	})
+
+	if cfg.HomebrewCaskToken != "" {
+		if err := validateHomebrewCaskToken(cfg.HomebrewCaskToken); err != nil {
+			failf(failureInput, "Issue with input: %s", err)
+		}
+	}
+
+	// Build settings
+	versions, err := newVersionOverrides(cfg.BuildNumber, cfg.BuildNumberOffset, cfg.MarketingVersion, os.Getenv("BITRISE_BUILD_NUMBER"))
+	if err != nil {
+		failf(failureInput, "Issue with input: %s", err)
+	}
+
+	buildSettings, err := parseBuildSettings(cfg.BuildSettings)
+	if err != nil {
+		failf(failureInput, "Issue with input: %s", err)
+	}
+	buildSettings = append(versions.buildSettings(), buildSettings...)
+
+	if cfg.XCConfigPath != "" {
+		absXCConfigPath, err := pathutil.AbsPath(cfg.XCConfigPath)
+		if err != nil {
+			failf(failureInput, "Failed to expand xcconfig path (%s), error: %s", cfg.XCConfigPath, err)
+		}
+		if exist, err := pathutil.IsPathExists(absXCConfigPath); err != nil {
+			failf(failureInput, "Failed to check if xcconfig (%s) exists, error: %s", absXCConfigPath, err)
+		} else if !exist {
+			failf(failureInput, "xcconfig (%s) does not exist", absXCConfigPath)
+		}
+		cfg.XCConfigPath = absXCConfigPath
+		log.Printf("- xcconfig: %s", cfg.XCConfigPath)
+	}
+
+	effectiveSettings, err := effectiveBuildSettings(ArchiveCommandOpts{
+		ForceTeamID:                       cfg.ForceTeamID,
+		ForceProvisioningProfileSpecifier: cfg.ForceProvisioningProfileSpecifier,
+		ForceProvisioningProfile:          cfg.ForceProvisioningProfile,
+		ForceCodeSignIdentity:             cfg.ForceCodeSignIdentity,
+		XcodebuildOptions:                 cfg.XcodebuildOptions,
+		DisableIndexWhileBuilding:         cfg.DisableIndexWhileBuilding,
+		BuildSettings:                     buildSettings,
+		XCConfigPath:                      cfg.XCConfigPath,
+	})
+	if err != nil {
+		failf(failureInput, "Issue with input: %s", err)
+	}
+
+	if len(effectiveSettings) > 0 {
+		log.Printf("- build settings:")
+		for _, setting := range effectiveSettings {
+			log.Printf("  %s (%s)", setting, setting.Source)
+		}
+	}
+
+	archiveDerivedData, err := newDerivedData(cfg.DerivedDataPath, cfg.XcodebuildOptions)
+	if err != nil {
+		failf(failureInput, "Issue with input: %s", err)
+	}
+	if cfg.DerivedDataPath != "" {
+		cfg.DerivedDataPath = archiveDerivedData.Dir
+	}
+	log.Printf("- derived data: %s", archiveDerivedData.Dir)
+
 	// Project-or-Workspace flag
 	action := ""
 	if strings.HasSuffix(cfg.ProjectPath, ".xcodeproj") {
@@ -263,7 +652,7 @@ func main() {
 	} else if strings.HasSuffix(cfg.ProjectPath, ".xcworkspace") {
 		action = "-workspace"
 	} else {
-		failf("Invalid project file (%s), extension should be (.xcodeproj/.xcworkspace)", cfg.ProjectPath)
+		failf(failureInput, "Invalid project file (%s), extension should be (.xcodeproj/.xcworkspace)", cfg.ProjectPath)
 	}
 
 	log.Printf("- action: %s", action)
@@ -275,27 +664,35 @@ func main() {
 	}
 	log.Printf("- export_format: %s", exportFormat)
 
+	zipOpts := zipOptions{
+		CompressionLevel: cfg.ZipCompressionLevel,
+		PreserveXattrs:   cfg.IsZipPreserveXattrs == "yes",
+	}
+
 	fmt.Println()
 
 	// abs out dir pth
 	absOutputDir, err := pathutil.AbsPath(cfg.OutputDir)
 	if err != nil {
-		failf("Failed to expand OutputDir (%s), error: %s", cfg.OutputDir, err)
+		failf(failureInput, "Failed to expand OutputDir (%s), error: %s", cfg.OutputDir, err)
 	}
 	cfg.OutputDir = absOutputDir
+	stepLifecycle.locked(func() {
+		outputDir = cfg.OutputDir
+	})
 
 	if exist, err := pathutil.IsPathExists(cfg.OutputDir); err != nil {
-		failf("Failed to check if OutputDir exist, error: %s", err)
+		failf(failureOutput, "Failed to check if OutputDir exist, error: %s", err)
 	} else if !exist {
 		if err := os.MkdirAll(cfg.OutputDir, 0777); err != nil {
-			failf("Failed to create OutputDir (%s), error: %s", cfg.OutputDir, err)
+			failf(failureOutput, "Failed to create OutputDir (%s), error: %s", cfg.OutputDir, err)
 		}
 	}
 
 	// output files
-	archiveTempDir, err := pathutil.NormalizedOSTempDirPath("bitrise-xcarchive")
+	archiveTempDir, err := stepLifecycle.tempDir("bitrise-xcarchive")
 	if err != nil {
-		failf("Failed to create archive tmp dir, error: %s", err)
+		failf(failureInternal, "Failed to create archive tmp dir, error: %s", err)
 	}
 
 	archivePath := filepath.Join(archiveTempDir, cfg.ArtifactName+".xcarchive")
@@ -304,6 +701,15 @@ func main() {
 	archiveZipPath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+".xcarchive.zip")
 	log.Printf("- archiveZipPath: %s", archiveZipPath)
 
+	xcresultPath := ""
+	if xcodeSupports(xcodebuildVersion.MajorVersion, xcodeCapabilityResultBundle) {
+		xcresultPath = filepath.Join(archiveTempDir, cfg.ArtifactName+".xcresult")
+		log.Printf("- xcresultPath: %s", xcresultPath)
+	}
+
+	xcresultZipPath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+".xcresult.zip")
+	log.Printf("- xcresultZipPath: %s", xcresultZipPath)
+
 	exportOptionsPath := filepath.Join(cfg.OutputDir, "export_options.plist")
 	log.Printf("- exportOptionsPath: %s", exportOptionsPath)
 
@@ -319,6 +725,57 @@ func main() {
 	ideDistributionLogsZipPath := filepath.Join(cfg.OutputDir, "xcodebuild.xcdistributionlogs.zip")
 	log.Printf("- ideDistributionLogsZipPath: %s", ideDistributionLogsZipPath)
 
+	artifactsIndexPath := filepath.Join(cfg.OutputDir, artifactsIndexFileName)
+	log.Printf("- artifactsIndexPath: %s", artifactsIndexPath)
+
+	sha256SumsPath := filepath.Join(cfg.OutputDir, sha256SumsFileName)
+	log.Printf("- sha256SumsPath: %s", sha256SumsPath)
+
+	resolvedPackagesPath := filepath.Join(cfg.OutputDir, "resolved-packages.json")
+	log.Printf("- resolvedPackagesPath: %s", resolvedPackagesPath)
+
+	sbomPath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+".cdx.json")
+	log.Printf("- sbomPath: %s", sbomPath)
+
+	archiveReportPath := filepath.Join(cfg.OutputDir, "archive-report.json")
+	log.Printf("- archiveReportPath: %s", archiveReportPath)
+
+	buildTimingPath := filepath.Join(cfg.OutputDir, "build-timing.json")
+	log.Printf("- buildTimingPath: %s", buildTimingPath)
+
+	stepResultPath := filepath.Join(cfg.OutputDir, stepResultFileName)
+	log.Printf("- stepResultPath: %s", stepResultPath)
+
+	stepMetricsPath := filepath.Join(cfg.OutputDir, "step-metrics.json")
+	log.Printf("- stepMetricsPath: %s", stepMetricsPath)
+
+	buildSummaryPath := filepath.Join(cfg.OutputDir, buildSummaryFileName)
+	log.Printf("- buildSummaryPath: %s", buildSummaryPath)
+
+	appIconPath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+"-icon.png")
+	log.Printf("- appIconPath: %s", appIconPath)
+
+	appcastPath := filepath.Join(cfg.OutputDir, "appcast.xml")
+	log.Printf("- appcastPath: %s", appcastPath)
+
+	// The cask token defaults to the app's name, the path of a derived token is only known once the archive is read.
+	homebrewCaskPath := ""
+	if cfg.HomebrewCaskToken != "" {
+		homebrewCaskPath = filepath.Join(cfg.OutputDir, cfg.HomebrewCaskToken+".rb")
+		log.Printf("- homebrewCaskPath: %s", homebrewCaskPath)
+	}
+
+	stepLifecycle.locked(func() {
+		logPointers = map[string]string{
+			bitriseXcodeRawResultTextEnvKey:     rawXcodebuildOutputLogPath,
+			bitriseXCResultZipPthEnvKey:         xcresultZipPath,
+			bitriseIDEDistributionLogsPthEnvKey: ideDistributionLogsZipPath,
+			bitriseArchiveReportPthEnvKey:       archiveReportPath,
+			bitriseBuildTimingPthEnvKey:         buildTimingPath,
+			bitriseBuildSummaryPthEnvKey:        buildSummaryPath,
+		}
+	})
+
 	fmt.Println()
 
 	// clean-up
@@ -326,19 +783,265 @@ func main() {
 		filePath,
 		dsymZipPath,
 		rawXcodebuildOutputLogPath,
+		ideDistributionLogsZipPath,
 		archiveZipPath,
+		xcresultZipPath,
 		exportOptionsPath,
+		artifactsIndexPath,
+		sha256SumsPath,
+		resolvedPackagesPath,
+		sbomPath,
+		archiveReportPath,
+		buildTimingPath,
+		stepResultPath,
+		stepMetricsPath,
+		buildSummaryPath,
+		appIconPath,
+	}
+	// The appcast of the previous releases may be read from the output directory, it is overwritten in that case.
+	if absSparkleAppcastPath, err := pathutil.AbsPath(cfg.SparkleAppcastPath); cfg.SparkleAppcastPath == "" || (err == nil && absSparkleAppcastPath != appcastPath) {
+		filesToCleanup = append(filesToCleanup, appcastPath)
+	}
+	if homebrewCaskPath != "" {
+		filesToCleanup = append(filesToCleanup, homebrewCaskPath)
 	}
 
 	for _, pth := range filesToCleanup {
 		if exist, err := pathutil.IsPathExists(pth); err != nil {
-			failf("Failed to check if path (%s) exist, error: %s", pth, err)
+			failf(failureOutput, "Failed to check if path (%s) exist, error: %s", pth, err)
 		} else if exist {
 			if err := os.RemoveAll(pth); err != nil {
-				failf("Failed to remove path (%s), error: %s", pth, err)
+				failf(failureOutput, "Failed to remove path (%s), error: %s", pth, err)
+			}
+		}
+	}
+
+	// Phase durations, exported and summarized on every exit path.
+	stepLifecycle.onExit(func(*stepError) {
+		total := time.Since(startTime)
+
+		fmt.Println()
+		log.Infof("Phase durations:")
+		fmt.Print(stepMetrics.summaryTable(total))
+
+		if err := stepMetrics.exportDurations(); err != nil {
+			log.Warnf("Failed to export the phase durations, error: %s", err)
+		}
+
+		if metrics, err := stepMetrics.json(total); err != nil {
+			log.Warnf("Failed to serialize the step metrics, error: %s", err)
+		} else if err := output.ExportOutputFileContent(metrics, stepMetricsPath, bitriseStepMetricsPthEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseStepMetricsPthEnvKey, err)
+		} else {
+			log.Donef("The step metrics path is now available in the Environment Variable: %s (value: %s)", bitriseStepMetricsPthEnvKey, stepMetricsPath)
+			addArtifact(stepMetricsPath, bitriseStepMetricsPthEnvKey)
+		}
+	})
+
+	// Scheme validation
+	log.Infof("Validating scheme ...")
+	fmt.Println()
+
+	archiveConfiguration := cfg.Configuration
+	if resolved, err := resolveScheme(cfg.ProjectPath, cfg.Scheme, cfg.Configuration); err != nil {
+		if _, ok := err.(schemeError); ok {
+			failf(failurePreflight, "Invalid scheme: %s", err)
+		}
+		log.Warnf("Failed to validate the scheme, error: %s", err)
+	} else {
+		log.Printf("- scheme: %s", resolved.Scheme.Path)
+		log.Printf("- configuration: %s", resolved.Configuration)
+		for _, target := range resolved.Targets() {
+			log.Printf("- target: %s (%s)", target.Name, target.BundleID(resolved.Configuration))
+		}
+		log.Donef("Scheme %s is valid", resolved.Scheme.Name)
+		archiveConfiguration = resolved.Configuration
+
+		if hardcoded, err := versions.hardcodedVersions(resolved); err != nil {
+			log.Warnf("Failed to check the Info.plist versions, error: %s", err)
+		} else {
+			for _, problem := range hardcoded {
+				log.Warnf("%s", problem)
+			}
+		}
+	}
+	fmt.Println()
+
+	var executedCommands []string
+	var xcresult *xcresultSummary
+	newArchiveReport := func() archiveReport {
+		return archiveReport{
+			ProjectPath:   cfg.ProjectPath,
+			Scheme:        cfg.Scheme,
+			Configuration: archiveConfiguration,
+			XcodeVersion:  xcodebuildVersion.Version,
+			XCConfigPath:  cfg.XCConfigPath,
+			BuildSettings: effectiveSettings,
+			Commands:      executedCommands,
+			XCResult:      xcresult,
+		}
+	}
+
+	// Build summary, rendered on every exit path with the artifacts and the result bundle available at that point.
+	stepSummary := buildSummary{ExportMethod: cfg.ExportMethod, OutputDir: cfg.OutputDir}
+	stepLifecycle.onExit(func(failure *stepError) {
+		var summary buildSummary
+		stepLifecycle.locked(func() {
+			summary = stepSummary
+			summary.Artifacts = append([]artifact{}, artifacts.Artifacts...)
+			summary.XCResult = xcresult
+		})
+		summary.Failure = failure
+
+		if err := output.ExportOutputFileContent(summary.markdown(), buildSummaryPath, bitriseBuildSummaryPthEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseBuildSummaryPthEnvKey, err)
+		} else {
+			log.Donef("The build summary path is now available in the Environment Variable: %s (value: %s)", bitriseBuildSummaryPthEnvKey, buildSummaryPath)
+			addArtifact(buildSummaryPath, bitriseBuildSummaryPthEnvKey)
+		}
+	})
+
+	// On failure, flush the archive report.
+	stepLifecycle.onExit(func(failure *stepError) {
+		if failure == nil {
+			return
+		}
+
+		var report archiveReport
+		stepLifecycle.locked(func() {
+			report = newArchiveReport()
+		})
+		if report, err := report.json(); err != nil {
+			log.Warnf("Failed to serialize the archive report, error: %s", err)
+		} else if err := output.ExportOutputFileContent(report, archiveReportPath, bitriseArchiveReportPthEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseArchiveReportPthEnvKey, err)
+		} else {
+			addArtifact(archiveReportPath, bitriseArchiveReportPthEnvKey)
+		}
+	})
+
+	// Swift package resolution
+	spmOpts := spmResolveOpts{
+		ProjectPath:                 cfg.ProjectPath,
+		Scheme:                      cfg.Scheme,
+		Configuration:               cfg.Configuration,
+		ClonedSourcePackagesDirPath: cfg.ClonedSourcePackagesPath,
+		DerivedDataPath:             cfg.DerivedDataPath,
+		Watchdog:                    watchdog,
+		Strict:                      cfg.IsStrictPackageResolution == "yes",
+		Retry:                       retryPolicy{Retries: cfg.PackageResolutionRetries, Signatures: retry.Signatures, Backoff: retry.Backoff, Sleep: retry.Sleep},
+	}
+
+	usesPackages, err := usesSwiftPackages(cfg.ProjectPath)
+	if err != nil {
+		log.Warnf("Failed to check if the project uses Swift packages, error: %s", err)
+		usesPackages = true
+	}
+
+	if usesPackages {
+		log.Infof("Resolving Swift package dependencies ...")
+		fmt.Println()
+
+		pins, retries, err := resolvePackages(spmOpts)
+		addRetries(retries)
+		if err != nil {
+			fail(commandError(failurePreflight, resolvePackagesCommand(spmOpts).PrintableCommandArgs(), err, "Failed to resolve Swift package dependencies, error: %s", err))
+		}
+
+		for _, pin := range pins {
+			version := pin.Version
+			if version == "" {
+				version = pin.Branch
+			}
+			log.Printf("- %s: %s (%s)", pin.Identity, version, pin.Revision)
+		}
+		fmt.Println()
+
+		pinsJSON, err := json.MarshalIndent(pins, "", "  ")
+		if err != nil {
+			failf(failureOutput, "Failed to serialize the resolved packages, error: %s", err)
+		}
+		if err := output.ExportOutputFileContent(string(pinsJSON), resolvedPackagesPath, bitriseResolvedPackagesPthEnvKey); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseResolvedPackagesPthEnvKey, err)
+		}
+
+		log.Donef("The resolved packages path is now available in the Environment Variable: %s (value: %s)", bitriseResolvedPackagesPthEnvKey, resolvedPackagesPath)
+		addArtifact(resolvedPackagesPath, bitriseResolvedPackagesPthEnvKey)
+		fmt.Println()
+	} else {
+		spmOpts = spmResolveOpts{}
+	}
+
+	// Preflight
+	if cfg.IsRunPreflight == "yes" {
+		log.Infof("Running project preflight checks ...")
+		fmt.Println()
+
+		targets, err := readTargetBuildSettings(cfg.ProjectPath, cfg.Scheme, cfg.Configuration, cfg.XCConfigPath, effectiveSettings)
+		if err != nil {
+			failf(failurePreflight, "Preflight failed, could not read build settings: %s", err)
+		}
+
+		var installedProfiles []profileutil.ProvisioningProfileInfoModel
+		checkProfiles := cfg.ExportMethod != "none" && cfg.CustomExportOptionsPlistContent == ""
+		if checkProfiles {
+			installedProfiles, err = profileutil.InstalledProvisioningProfileInfos(profileutil.ProfileTypeMacOs)
+			if err != nil {
+				failf(failurePreflight, "Failed to get installed provisioning profiles, error: %s", err)
 			}
 		}
+
+		for _, target := range targets {
+			log.Printf("- %s: %s (%s, %s)", target.Target, target.setting("PRODUCT_BUNDLE_IDENTIFIER"), target.setting("CONFIGURATION"), target.setting("CODE_SIGN_STYLE"))
+		}
+
+		problems := preflightProblems(targets, preflightOpts{
+			Configuration:                     cfg.Configuration,
+			ExportMethod:                      cfg.ExportMethod,
+			ForceCodeSignIdentity:             cfg.ForceCodeSignIdentity,
+			ForceProvisioningProfileSpecifier: cfg.ForceProvisioningProfileSpecifier,
+			ForceProvisioningProfile:          cfg.ForceProvisioningProfile,
+			CheckProfiles:                     checkProfiles,
+		}, installedProfiles)
+		if len(problems) > 0 {
+			failf(failurePreflight, "Preflight failed, found %d problem(s):\n- %s", len(problems), strings.Join(problems, "\n- "))
+		}
+
+		log.Donef("Preflight checks passed")
+		fmt.Println()
+	}
+
+	// Build cache
+	log.Infof("Checking the build cache ...")
+	fmt.Println()
+
+	hasBuildProducts, err := archiveDerivedData.hasBuildProducts(cfg.ProjectPath)
+	if err != nil {
+		log.Warnf("Failed to check the derived data, error: %s", err)
+	}
+	isCleanBuild := shouldClean(cfg.CleanPolicy, hasBuildProducts)
+	log.Printf("- build products cached: %t", hasBuildProducts)
+	log.Printf("- clean build (%s): %t", cfg.CleanPolicy, isCleanBuild)
+
+	lockfiles, err := projectLockfiles(cfg.ProjectPath)
+	if err != nil {
+		failf(failureInternal, "Failed to search for the dependency lockfiles, error: %s", err)
+	}
+	for _, lockfile := range lockfiles {
+		log.Printf("- lockfile: %s", lockfile)
+	}
+
+	cacheKey, err := buildCacheKey(xcodebuildVersion.Version, cfg.Scheme, archiveConfiguration, lockfiles)
+	if err != nil {
+		failf(failureInternal, "Failed to compute the build cache key, error: %s", err)
 	}
+	fmt.Println()
+
+	if err := tools.ExportEnvironmentWithEnvman(bitriseBuildCacheKeyEnvKey, cacheKey); err != nil {
+		failf(failureOutput, "Failed to export %s, error: %s", bitriseBuildCacheKeyEnvKey, err)
+	}
+	log.Donef("The build cache key is now available in the Environment Variable: %s (value: %s)", bitriseBuildCacheKeyEnvKey, cacheKey)
+	fmt.Println()
 
 	//
 	// Create the Archive with Xcode Command Line tools
@@ -352,11 +1055,12 @@ func main() {
 	} else if ext == ".xcworkspace" {
 		isWorkspace = true
 	} else {
-		failf("Project file extension should be .xcodeproj or .xcworkspace, but got: %s", ext)
+		failf(failureInput, "Project file extension should be .xcodeproj or .xcworkspace, but got: %s", ext)
 	}
 
-	archiveCmd := createArchiveCmd(ArchiveCommandOpts{
-		IsCleanBuild:                      cfg.IsCleanBuild,
+	archiveCmd, err := createArchiveCmd(ArchiveCommandOpts{
+		IsCleanBuild:                      isCleanBuild,
+		DerivedDataPath:                   cfg.DerivedDataPath,
 		ProjectPath:                       cfg.ProjectPath,
 		IsWorkspace:                       isWorkspace,
 		Scheme:                            cfg.Scheme,
@@ -367,73 +1071,234 @@ func main() {
 		ForceCodeSignIdentity:             cfg.ForceCodeSignIdentity,
 		ArchivePath:                       archivePath,
 		XcodebuildOptions:                 cfg.XcodebuildOptions,
+		DisableIndexWhileBuilding:         cfg.DisableIndexWhileBuilding,
+		PackageOptions:                    spmOpts.xcodebuildOptions(),
+		BuildSettings:                     buildSettings,
+		XCConfigPath:                      cfg.XCConfigPath,
+		ResultBundlePath:                  xcresultPath,
+	})
+	if err != nil {
+		failf(failureInput, "Failed to create archive command, error: %s", err)
+	}
+
+	stepLifecycle.locked(func() {
+		executedCommands = append(executedCommands, archiveCmd.PrintableCmd())
 	})
 
+	// exportResultBundle exports the zipped result bundle of the archive action and returns its summary,
+	// or nil if the result bundle is not available.
+	exportResultBundle := func() *xcresultSummary {
+		if xcresultPath == "" {
+			return nil
+		}
+		if exist, err := pathutil.IsDirExists(xcresultPath); err != nil {
+			log.Warnf("Failed to check if result bundle (%s) exists, error: %s", xcresultPath, err)
+			return nil
+		} else if !exist {
+			log.Warnf("No result bundle generated at: %s", xcresultPath)
+			return nil
+		}
+
+		if err := zipAndExportOutput([]string{xcresultPath}, xcresultZipPath, bitriseXCResultZipPthEnvKey, zipOpts); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseXCResultZipPthEnvKey, err)
+		} else {
+			log.Donef("The result bundle zip path is now available in the Environment Variable: %s (value: %s)", bitriseXCResultZipPthEnvKey, xcresultZipPath)
+			addArtifact(xcresultZipPath, bitriseXCResultZipPthEnvKey)
+		}
+
+		summary, err := readXCResult(xcresultPath, xcresultToolLoader(xcodeSupports(xcodebuildVersion.MajorVersion, xcodeCapabilityLegacyXCResultTool)))
+		if err != nil {
+			log.Warnf("Failed to read the result bundle, error: %s", err)
+			return nil
+		}
+		return &summary
+	}
+
+	// failArchive fails with the errors of the result bundle, the output of xcodebuild is only used if the result bundle has no error.
+	failArchive := func(summary *xcresultSummary, err error) {
+		if _, isHang := err.(*hangError); isHang {
+			fail(commandError(failureArchive, archiveCmd.PrintableCmd(), err, "Archive failed, %s", err))
+		}
+		if summary != nil {
+			if message := summary.failureMessage(); message != "" {
+				fail(commandError(failureArchive, archiveCmd.PrintableCmd(), err, "Archive failed with %s", message))
+			}
+		}
+		fail(commandError(failureArchive, archiveCmd.PrintableCmd(), err, "Archive failed, error: %s", err))
+	}
+
+	archiveStarted := time.Now()
+
+	printableArchiveCmd := archiveCmd.PrintableCmd()
 	if outputTool == "xcpretty" {
-		xcprettyCmd := xcpretty.New(archiveCmd)
+		printableArchiveCmd = xcpretty.New(archiveCmd).PrintableCmd()
+	}
+	log.TSuccessf("$ %s", printableArchiveCmd)
+	fmt.Println()
 
-		log.TSuccessf("$ %s", xcprettyCmd.PrintableCmd())
+	rawXcodebuildOut, retries, err := retry.run("Archive", func() (string, error) {
+		// xcodebuild fails if the result bundle of a previous attempt exists.
+		if xcresultPath != "" {
+			if err := os.RemoveAll(xcresultPath); err != nil {
+				return "", err
+			}
+		}
+		return runXcodebuild("archive", archiveCmd, outputTool, watchdog)
+	})
+	stepMetrics.measure(phaseArchive, archiveStarted)
+	addRetries(retries)
+	if err != nil {
 		fmt.Println()
+		summary := exportResultBundle()
+		stepLifecycle.locked(func() {
+			xcresult = summary
+		})
 
-		if rawXcodebuildOut, err := xcprettyCmd.Run(); err != nil {
-
+		if _, isHang := err.(*hangError); !isHang && (summary == nil || summary.failureMessage() == "") {
 			log.Errorf("\nLast lines of the Xcode's build log:")
 			fmt.Println(stringutil.LastNLines(rawXcodebuildOut, 10))
+		}
 
-			if err := output.ExportOutputFileContent(rawXcodebuildOut, rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey); err != nil {
-				log.Warnf("Failed to export %s, error: %s", bitriseXcodeRawResultTextEnvKey, err)
-			} else {
-				log.Warnf(`You can find the last couple of lines of Xcode's build log above, but the full log is also available in the raw-xcodebuild-output.log
+		if err := output.ExportOutputFileContent(rawXcodebuildOut, rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey); err != nil {
+			log.Warnf("Failed to export %s, error: %s", bitriseXcodeRawResultTextEnvKey, err)
+		} else {
+			addArtifact(rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey)
+			log.Warnf(`You can find the last couple of lines of Xcode's build log above, but the full log is also available in the raw-xcodebuild-output.log
 The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in the $BITRISE_XCODE_RAW_RESULT_TEXT_PATH environment variable
 (value: %s)`, rawXcodebuildOutputLogPath)
-			}
+		}
 
-			failf("Archive failed, error: %s", err)
+		failArchive(summary, err)
+	}
+
+	fmt.Println()
+	archiveResult := exportResultBundle()
+	stepLifecycle.locked(func() {
+		xcresult = archiveResult
+	})
+	if xcresult != nil {
+		for _, action := range xcresult.Actions {
+			log.Printf("- %s: %s in %s", action.Name, action.Status, action.Duration.Round(time.Millisecond))
 		}
-	} else {
-		log.TSuccessf("$ %s", archiveCmd.PrintableCmd())
+		log.Printf("- %d error(s), %d warning(s), %d analyzer warning(s)",
+			len(xcresult.IssuesWithSeverity(xcresultSeverityError)),
+			len(xcresult.IssuesWithSeverity(xcresultSeverityWarning)),
+			len(xcresult.IssuesWithSeverity(xcresultSeverityAnalyzerWarning)))
+	}
+
+	// Build timing
+	if cfg.IsGenerateTiming == "yes" {
+		fmt.Println()
+		log.Infof("Analyzing build timing ...")
 		fmt.Println()
 
-		if err := archiveCmd.Run(); err != nil {
-			failf("Archive failed, error: %s", err)
+		if err := exportBuildTiming(archiveDerivedData.Dir, archiveStarted, buildTimingPath); err != nil {
+			log.Warnf("Failed to analyze the build timing, error: %s", err)
+		} else {
+			log.Donef("The build timing path is now available in the Environment Variable: %s (value: %s)", bitriseBuildTimingPthEnvKey, buildTimingPath)
+			addArtifact(buildTimingPath, bitriseBuildTimingPthEnvKey)
+		}
+	}
+
+	// Export the cached directories, the derived data of the shared derived data directory is only known after the build
+	fmt.Println()
+	if dir, err := archiveDerivedData.projectDir(cfg.ProjectPath); err != nil {
+		log.Warnf("Failed to find the derived data of the project, error: %s", err)
+	} else if dir != "" {
+		if err := tools.ExportEnvironmentWithEnvman(bitriseDerivedDataPathEnvKey, dir); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseDerivedDataPathEnvKey, err)
+		}
+		log.Donef("The derived data path is now available in the Environment Variable: %s (value: %s)", bitriseDerivedDataPathEnvKey, dir)
+	}
+
+	if usesPackages {
+		if dir, err := archiveDerivedData.sourcePackagesDir(cfg.ProjectPath, cfg.ClonedSourcePackagesPath); err != nil {
+			log.Warnf("Failed to find the Swift package cache, error: %s", err)
+		} else if dir != "" {
+			if err := tools.ExportEnvironmentWithEnvman(bitriseSPMCachePathEnvKey, dir); err != nil {
+				failf(failureOutput, "Failed to export %s, error: %s", bitriseSPMCachePathEnvKey, err)
+			}
+			log.Donef("The Swift package cache path is now available in the Environment Variable: %s (value: %s)", bitriseSPMCachePathEnvKey, dir)
 		}
 	}
 
 	// Ensure xcarchive exists
+	xcarchiveParsingStarted := time.Now()
 	if exist, err := pathutil.IsPathExists(archivePath); err != nil {
-		failf("Failed to check if archive exist, error: %s", err)
+		failf(failureArchive, "Failed to check if archive exist, error: %s", err)
 	} else if !exist {
-		failf("No archive generated at: %s", archivePath)
+		failf(failureArchive, "No archive generated at: %s", archivePath)
 	}
 
 	archive, err := xcarchive.NewMacosArchive(archivePath)
 	if err != nil {
-		failf("Failed to parse archive, error: %s", err)
+		failf(failureArchive, "Failed to parse archive, error: %s", err)
+	}
+	stepMetrics.measure(phaseXCArchiveParsing, xcarchiveParsingStarted)
+
+	if cfg.HomebrewCaskToken == "" {
+		// clean-up the cask of the token derived from the app's name
+		homebrewCaskPath = filepath.Join(cfg.OutputDir, homebrewCaskToken(appNameFromArchive(archive))+".rb")
+		if err := os.RemoveAll(homebrewCaskPath); err != nil {
+			failf(failureOutput, "Failed to remove path (%s), error: %s", homebrewCaskPath, err)
+		}
+	}
+
+	if mismatches := versions.infoPlistMismatches(archive.Application.InfoPlist); len(mismatches) > 0 {
+		failf(failureArchive, "The archived app's Info.plist does not contain the requested versions:\n- %s", strings.Join(mismatches, "\n- "))
 	}
 
 	identity := archive.SigningIdentity()
 
+	stepLifecycle.locked(func() {
+		stepSummary.setApplication(archive)
+		stepSummary.SigningIdentity = identity
+		stepSummary.setProfiles(archive.BundleIDProfileInfoMap())
+	})
+
 	log.Infof("Archive infos:")
 	log.Printf("codesign identity: %v", identity)
 	fmt.Println()
 
+	// App icon
+	log.Infof("Extracting app icon ...")
+	fmt.Println()
+
+	if icon, err := extractAppIcon(archive.Application.Path, archive.Application.InfoPlist); err != nil {
+		log.Warnf("Failed to extract the app icon, error: %s", err)
+	} else {
+		log.Printf("- icon: %s (%dx%d)", icon.Source, icon.Size, icon.Size)
+
+		if err := output.ExportOutputFileContent(string(icon.PNG), appIconPath, bitriseAppIconPthEnvKey); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseAppIconPthEnvKey, err)
+		}
+		log.Donef("The app icon path is now available in the Environment Variable: %s (value: %s)", bitriseAppIconPthEnvKey, appIconPath)
+		addArtifact(appIconPath, bitriseAppIconPthEnvKey)
+		stepLifecycle.locked(func() {
+			stepSummary.IconPath = appIconPath
+		})
+	}
+	fmt.Println()
+
 	// Exporting xcarchive
 	fmt.Println()
 	log.Infof("Exporting xcarchive ...")
 	fmt.Println()
 
 	if err := output.ExportOutputDir(archivePath, archivePath, bitriseXCArchiveDirPthEnvKey); err != nil {
-		failf("Failed to export %s, error: %s", bitriseXCArchiveDirPthEnvKey, err)
+		failf(failureOutput, "Failed to export %s, error: %s", bitriseXCArchiveDirPthEnvKey, err)
 	}
 
+	stepLifecycle.keep(archiveTempDir)
 	log.Donef("The xcarchive path is now available in the Environment Variable: %s (value: %s)", bitriseXCArchiveDirPthEnvKey, archivePath)
 
 	if cfg.IsExportXcarchiveZip == "yes" {
-		if err := output.ZipAndExportOutput([]string{archivePath}, archiveZipPath, bitriseXCArchivePthEnvKey); err != nil {
-			failf("Failed to export %s, error: %s", bitriseXCArchivePthEnvKey, err)
+		if err := zipAndExportOutput([]string{archivePath}, archiveZipPath, bitriseXCArchivePthEnvKey, zipOpts); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseXCArchivePthEnvKey, err)
 		}
 
 		log.Donef("The xcarchive zip path is now available in the Environment Variable: %s (value: %s)", bitriseXCArchivePthEnvKey, archiveZipPath)
+		addArtifact(archiveZipPath, bitriseXCArchivePthEnvKey)
 	}
 
 	fmt.Println()
@@ -444,10 +1309,12 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 	envsToUnset := []string{"GEM_HOME", "GEM_PATH", "RUBYLIB", "RUBYOPT", "BUNDLE_BIN_PATH", "_ORIGINAL_GEM_PATH", "BUNDLE_GEMFILE"}
 	for _, key := range envsToUnset {
 		if err := os.Unsetenv(key); err != nil {
-			failf("Failed to unset (%s), error: %s", key, err)
+			failf(failureInternal, "Failed to unset (%s), error: %s", key, err)
 		}
 	}
 
+	var exportCodeSignGroup *export.MacCodeSignGroup
+
 	// Legacy
 	if cfg.ExportMethod == "none" {
 		log.Printf("Export a copy of the application without re-signing...")
@@ -456,37 +1323,38 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 		embeddedAppPattern := filepath.Join(archivePath, "Products", "Applications", "*.app")
 		matches, err := filepath.Glob(embeddedAppPattern)
 		if err != nil {
-			failf("Failed to find embedded app with pattern: %s, error: %s", embeddedAppPattern, err)
+			failf(failureExport, "Failed to find embedded app with pattern: %s, error: %s", embeddedAppPattern, err)
 		}
 
 		if len(matches) == 0 {
-			failf("No embedded app found with pattern: %s", embeddedAppPattern)
+			failf(failureExport, "No embedded app found with pattern: %s", embeddedAppPattern)
 		} else if len(matches) > 1 {
-			failf("Multiple embedded app found with pattern: %s", embeddedAppPattern)
+			failf(failureExport, "Multiple embedded app found with pattern: %s", embeddedAppPattern)
 		}
 
 		embeddedAppPath := matches[0]
 		appPath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+".app")
 
 		if err := output.ExportOutputDir(embeddedAppPath, appPath, bitriseAppPthEnvKey); err != nil {
-			failf("Failed to export %s, error: %s", bitriseAppPthEnvKey, err)
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseAppPthEnvKey, err)
 		}
 
 		log.Donef("The app path is now available in the Environment Variable: %s (value: %s)", bitriseAppPthEnvKey, appPath)
 
 		filePath = filePath + ".zip"
-		if err := output.ZipAndExportOutput([]string{embeddedAppPath}, filePath, bitriseExportedFilePath); err != nil {
-			failf("Failed to export %s, error: %s", bitriseExportedFilePath, err)
+		if err := zipAndExportOutput([]string{embeddedAppPath}, filePath, bitriseExportedFilePath, zipOpts); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseExportedFilePath, err)
 		}
 
 		log.Donef("The app.zip path is now available in the Environment Variable: %s (value: %s)", bitriseExportedFilePath, filePath)
+		addArtifact(filePath, bitriseExportedFilePath)
 	} else {
 		// export using exportOptions
 		log.Printf("Export using exportOptions...")
 
-		exportTmpDir, err := pathutil.NormalizedOSTempDirPath("__export__")
+		exportTmpDir, err := stepLifecycle.tempDir("__export__")
 		if err != nil {
-			failf("Failed to create export tmp dir, error: %s", err)
+			failf(failureInternal, "Failed to create export tmp dir, error: %s", err)
 		}
 
 		exportCmd := xcodebuild.NewExportCommand()
@@ -498,12 +1366,12 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 			fmt.Println(cfg.CustomExportOptionsPlistContent)
 
 			if err := fileutil.WriteStringToFile(exportOptionsPath, cfg.CustomExportOptionsPlistContent); err != nil {
-				failf("Failed to write export options to file, error: %s", err)
+				failf(failureExport, "Failed to write export options to file, error: %s", err)
 			}
 		} else {
 			exportMethod, err := exportoptions.ParseMethod(cfg.ExportMethod)
 			if err != nil {
-				failf("Failed to parse export method, error: %s", err)
+				failf(failureInput, "Failed to parse export method, error: %s", err)
 			}
 
 			var macCSGroup *export.MacCodeSignGroup
@@ -512,9 +1380,10 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 			// We do not need provisioning profile for the export if the app in the generated XcArchive doesn't
 			// contain embedded provisioning profile.
 			if archive.Application.ProvisioningProfile != nil {
+				codeSignResolutionStarted := time.Now()
 				installedCertificates, err := certificateutil.InstalledCodesigningCertificateInfos()
 				if err != nil {
-					failf("Failed to get installed certificates, error: %s", err)
+					failf(failureCodeSign, "Failed to get installed certificates, error: %s", err)
 				}
 				certificates := certificateutil.FilterValidCertificateInfos(installedCertificates)
 				validCertificates := append(certificates.ValidCertificates, certificates.DuplicatedCertificates...)
@@ -534,7 +1403,7 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 
 				installedProfiles, err := profileutil.InstalledProvisioningProfileInfos(profileutil.ProfileTypeMacOs)
 				if err != nil {
-					failf("Failed to get installed provisioning profiles, error: %s", err)
+					failf(failureCodeSign, "Failed to get installed provisioning profiles, error: %s", err)
 				}
 
 				log.Debugf("\n")
@@ -567,10 +1436,16 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 
 				macCSGroup, err = macCodeSignGroup(archive, validCertificates, validInstallerCertificates, installedProfiles, exportMethod, cfg)
 				if err != nil {
-					failf("Failed to find code sign groups for the project, error: %s", err)
+					failf(failureCodeSign, "Failed to find code sign groups for the project, error: %s", err)
 				}
+				stepMetrics.measure(phaseCodeSignResolution, codeSignResolutionStarted)
 
 				if macCSGroup != nil {
+					exportCodeSignGroup = macCSGroup
+					stepLifecycle.locked(func() {
+						stepSummary.SigningIdentity = macCSGroup.Certificate().CommonName
+						stepSummary.setProfiles(macCSGroup.BundleIDProfileMap())
+					})
 					for bundleID, profileInfo := range macCSGroup.BundleIDProfileMap() {
 						exportProfileMapping[bundleID] = profileInfo.Name
 					}
@@ -609,97 +1484,93 @@ The log file is stored in $BITRISE_DEPLOY_DIR, and its full path is available in
 			fmt.Println(exportOpts.String())
 
 			if err = exportOpts.WriteToFile(exportOptionsPath); err != nil {
-				failf("Failed to write export options to file, error: %s", err)
+				failf(failureExport, "Failed to write export options to file, error: %s", err)
 			}
 		}
 
 		exportCmd.SetExportOptionsPlist(exportOptionsPath)
+		stepLifecycle.locked(func() {
+			executedCommands = append(executedCommands, exportCmd.PrintableCmd())
+		})
+		addArtifact(exportOptionsPath, "")
 
+		printableExportCmd := exportCmd.PrintableCmd()
 		if outputTool == "xcpretty" {
-			xcprettyCmd := xcpretty.New(exportCmd)
-
-			log.Donef("$ %s", xcprettyCmd.PrintableCmd())
-			fmt.Println()
+			printableExportCmd = xcpretty.New(exportCmd).PrintableCmd()
+		}
+		log.Donef("$ %s", printableExportCmd)
+		fmt.Println()
 
-			if xcodebuildOut, err := xcprettyCmd.Run(); err != nil {
-				// xcodebuild raw output
-				if err := output.ExportOutputFileContent(xcodebuildOut, rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey); err != nil {
-					log.Warnf("Failed to export %s, error: %s", bitriseXcodeRawResultTextEnvKey, err)
-				} else {
-					log.Warnf(`If you can't find the reason of the error in the log, please check the raw-xcodebuild-output.log
+		exportStarted := time.Now()
+		xcodebuildOut, retries, err := retry.run("Export", func() (string, error) {
+			// Start every attempt with an empty export directory.
+			if err := os.RemoveAll(exportTmpDir); err != nil {
+				return "", err
+			}
+			if err := os.MkdirAll(exportTmpDir, 0755); err != nil {
+				return "", err
+			}
+			return runXcodebuild("export", exportCmd, outputTool, watchdog)
+		})
+		stepMetrics.measure(phaseExport, exportStarted)
+		addRetries(retries)
+		if err != nil {
+			// xcodebuild raw output
+			if err := output.ExportOutputFileContent(xcodebuildOut, rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey); err != nil {
+				log.Warnf("Failed to export %s, error: %s", bitriseXcodeRawResultTextEnvKey, err)
+			} else {
+				addArtifact(rawXcodebuildOutputLogPath, bitriseXcodeRawResultTextEnvKey)
+				log.Warnf(`If you can't find the reason of the error in the log, please check the raw-xcodebuild-output.log
 The log file is stored in $BITRISE_DEPLOY_DIR, and its full path
 is available in the $BITRISE_XCODE_RAW_RESULT_TEXT_PATH environment variable (value: %s)`, rawXcodebuildOutputLogPath)
-				}
-
-				// xcdistributionlogs
-				if logsDirPth, err := findIDEDistrubutionLogsPath(xcodebuildOut); err != nil {
-					log.Warnf("Failed to find xcdistributionlogs, error: %s", err)
-				} else if err := output.ZipAndExportOutput([]string{logsDirPth}, ideDistributionLogsZipPath, bitriseIDEDistributionLogsPthEnvKey); err != nil {
-					log.Warnf("Failed to export %s, error: %s", bitriseIDEDistributionLogsPthEnvKey, err)
-				} else {
-					criticalDistLogFilePth := filepath.Join(logsDirPth, "IDEDistribution.critical.log")
-					log.Warnf("IDEDistribution.critical.log:")
-					if criticalDistLog, err := fileutil.ReadStringFromFile(criticalDistLogFilePth); err == nil {
-						log.Printf(criticalDistLog)
-					}
-
-					log.Warnf(`If you can't find the reason of the error in the log, please check the xcdistributionlogs
-The logs directory is stored in $BITRISE_DEPLOY_DIR, and its full path
-is available in the $BITRISE_IDEDISTRIBUTION_LOGS_PATH environment variable (value: %s)`, ideDistributionLogsZipPath)
-				}
-
-				failf("Export failed, error: %s", err)
 			}
-		} else {
-			log.Donef("$ %s", exportCmd.PrintableCmd())
-			fmt.Println()
 
-			if xcodebuildOut, err := exportCmd.RunAndReturnOutput(); err != nil {
-				// xcdistributionlogs
-				if logsDirPth, err := findIDEDistrubutionLogsPath(xcodebuildOut); err != nil {
-					log.Warnf("Failed to find xcdistributionlogs, error: %s", err)
-				} else if err := output.ZipAndExportOutput([]string{logsDirPth}, ideDistributionLogsZipPath, bitriseIDEDistributionLogsPthEnvKey); err != nil {
-					log.Warnf("Failed to export %s, error: %s", bitriseIDEDistributionLogsPthEnvKey, err)
-				} else {
-					criticalDistLogFilePth := filepath.Join(logsDirPth, "IDEDistribution.critical.log")
-					log.Warnf("IDEDistribution.critical.log:")
-					if criticalDistLog, err := fileutil.ReadStringFromFile(criticalDistLogFilePth); err == nil {
-						log.Printf(criticalDistLog)
-					}
+			// xcdistributionlogs
+			if logsDirPth, err := findIDEDistrubutionLogsPath(xcodebuildOut); err != nil {
+				log.Warnf("Failed to find xcdistributionlogs, error: %s", err)
+			} else if err := zipAndExportOutput([]string{logsDirPth}, ideDistributionLogsZipPath, bitriseIDEDistributionLogsPthEnvKey, zipOpts); err != nil {
+				log.Warnf("Failed to export %s, error: %s", bitriseIDEDistributionLogsPthEnvKey, err)
+			} else {
+				addArtifact(ideDistributionLogsZipPath, bitriseIDEDistributionLogsPthEnvKey)
+				criticalDistLogFilePth := filepath.Join(logsDirPth, "IDEDistribution.critical.log")
+				log.Warnf("IDEDistribution.critical.log:")
+				if criticalDistLog, err := fileutil.ReadStringFromFile(criticalDistLogFilePth); err == nil {
+					log.Printf(criticalDistLog)
+				}
 
-					log.Warnf(`If you can't find the reason of the error in the log, please check the xcdistributionlogs
+				log.Warnf(`If you can't find the reason of the error in the log, please check the xcdistributionlogs
 The logs directory is stored in $BITRISE_DEPLOY_DIR, and its full path
 is available in the $BITRISE_IDEDISTRIBUTION_LOGS_PATH environment variable (value: %s)`, ideDistributionLogsZipPath)
-				}
-
-				failf("Export failed, error: %s", err)
 			}
+
+			fail(commandError(failureExport, exportCmd.PrintableCmd(), err, "Export failed, error: %s", err))
 		}
 
 		// find exported app
 		pattern := filepath.Join(exportTmpDir, "*."+exportFormat)
 		apps, err := filepath.Glob(pattern)
 		if err != nil {
-			failf("Failed to find app, with pattern: %s, error: %s", pattern, err)
+			failf(failureExport, "Failed to find app, with pattern: %s, error: %s", pattern, err)
 		}
 
 		if len(apps) > 0 {
 			if exportFormat == "pkg" {
 				if err := output.ExportOutputFile(apps[0], filePath, bitriseExportedFilePath); err != nil {
-					failf("Failed to export %s, error: %s", bitriseExportedFilePath, err)
+					failf(failureOutput, "Failed to export %s, error: %s", bitriseExportedFilePath, err)
 				}
 			} else {
 				if err := tools.ExportEnvironmentWithEnvman(bitriseAppPthEnvKey, filePath); err != nil {
-					failf("Failed to export %s, error: %s", bitriseAppPthEnvKey, err)
+					failf(failureOutput, "Failed to export %s, error: %s", bitriseAppPthEnvKey, err)
 				}
 				filePath = filePath + ".zip"
-				if err := output.ZipAndExportOutput([]string{apps[0]}, filePath, bitriseExportedFilePath); err != nil {
-					failf("Failed to export %s, error: %s", bitriseExportedFilePath, err)
+				if err := zipAndExportOutput([]string{apps[0]}, filePath, bitriseExportedFilePath, zipOpts); err != nil {
+					failf(failureOutput, "Failed to export %s, error: %s", bitriseExportedFilePath, err)
 				}
 			}
 
 			fmt.Println()
 			log.Donef("The app path is now available in the Environment Variable: %s (value: %s)", bitriseExportedFilePath, filePath)
+			addArtifact(filePath, bitriseExportedFilePath)
 		}
 	}
 
@@ -708,39 +1579,257 @@ is available in the $BITRISE_IDEDISTRIBUTION_LOGS_PATH environment variable (val
 	log.Infof("Exporting dSYM files ...")
 	fmt.Println()
 
+	dsymCollectionStarted := time.Now()
 	appDSYMs, frameworkDSYMs, err := archive.FindDSYMs()
 	if err != nil {
-		failf("Failed to export dsyms, error: %s", err)
+		failf(failureDSYM, "Failed to export dsyms, error: %s", err)
 	}
 
-	dsymDir, err := pathutil.NormalizedOSTempDirPath("__dsyms__")
+	dsymTmpDir, err := stepLifecycle.tempDir("__dsyms__")
 	if err != nil {
-		failf("Failed to create tmp dir, error: %s", err)
+		failf(failureDSYM, "Failed to create tmp dir, error: %s", err)
+	}
+
+	// The zip entries are rooted at the directory's name, a fixed name keeps the zip reproducible.
+	dsymDir := filepath.Join(dsymTmpDir, "dSYMs")
+	if err := os.Mkdir(dsymDir, 0755); err != nil {
+		failf(failureDSYM, "Failed to create dSYMs dir, error: %s", err)
+	}
+	if err := os.Chmod(dsymDir, 0755); err != nil {
+		failf(failureDSYM, "Failed to set the permissions of the dSYMs dir, error: %s", err)
 	}
 
 	for _, dsym := range appDSYMs {
 		if err := command.CopyDir(dsym, dsymDir, false); err != nil {
-			failf("Failed to copy (%s) -> (%s), error: %s", appDSYMs, dsymDir, err)
+			failf(failureDSYM, "Failed to copy (%s) -> (%s), error: %s", appDSYMs, dsymDir, err)
 		}
 	}
 
 	if cfg.IsExportAllDsyms == "yes" {
 		for _, dsym := range frameworkDSYMs {
 			if err := command.CopyDir(dsym, dsymDir, false); err != nil {
-				failf("Failed to copy (%s) -> (%s), error: %s", dsym, dsymDir, err)
+				failf(failureDSYM, "Failed to copy (%s) -> (%s), error: %s", dsym, dsymDir, err)
 			}
 		}
 	}
 
-	if err := output.ZipAndExportOutput([]string{dsymDir}, dsymZipPath, bitriseDSYMDirPthEnvKey); err != nil {
-		failf("Failed to export %s, error: %s", bitriseDSYMDirPthEnvKey, err)
+	stepMetrics.measure(phaseDSYMCollection, dsymCollectionStarted)
+
+	if err := zipAndExportOutput([]string{dsymDir}, dsymZipPath, bitriseDSYMDirPthEnvKey, zipOpts); err != nil {
+		failf(failureDSYM, "Failed to export %s, error: %s", bitriseDSYMDirPthEnvKey, err)
 	}
 
 	log.Donef("The dSYM dir path is now available in the Environment Variable: %s (value: %s)", bitriseDSYMDirPthEnvKey, dsymZipPath)
+	addArtifact(dsymZipPath, bitriseDSYMDirPthEnvKey)
+
+	// SBOM
+	if cfg.IsGenerateSBOM == "yes" {
+		fmt.Println()
+		log.Infof("Generating software bill of materials ...")
+		fmt.Println()
+
+		pins, err := readPackageResolved(packageResolvedPath(cfg.ProjectPath))
+		if err != nil && !os.IsNotExist(err) {
+			failf(failureOutput, "Failed to read the resolved Swift packages, error: %s", err)
+		}
+
+		appVersion, _ := archive.Application.InfoPlist.GetString("CFBundleShortVersionString")
+		bom, err := newCycloneDXBOM(sbomParams{
+			AppName:     appNameFromArchive(archive),
+			AppVersion:  appVersion,
+			BundleID:    archive.Application.BundleIdentifier(),
+			AppPath:     archive.Application.Path,
+			ProjectDir:  filepath.Dir(cfg.ProjectPath),
+			PackagePins: pins,
+			GeneratedAt: time.Now(),
+		})
+		if err != nil {
+			failf(failureOutput, "Failed to generate the SBOM, error: %s", err)
+		}
+
+		for _, component := range bom.Components {
+			log.Printf("- %s %s (%s)", component.Name, component.Version, component.Type)
+		}
+		fmt.Println()
+
+		bomJSON, err := json.MarshalIndent(bom, "", "  ")
+		if err != nil {
+			failf(failureOutput, "Failed to serialize the SBOM, error: %s", err)
+		}
+		if err := output.ExportOutputFileContent(string(bomJSON), sbomPath, bitriseSBOMPthEnvKey); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseSBOMPthEnvKey, err)
+		}
+
+		log.Donef("The SBOM path is now available in the Environment Variable: %s (value: %s)", bitriseSBOMPthEnvKey, sbomPath)
+		addArtifact(sbomPath, bitriseSBOMPthEnvKey)
+	}
+
+	// Sparkle appcast
+	if cfg.IsGenerateSparkleAppcast == "yes" {
+		fmt.Println()
+		log.Infof("Generating Sparkle appcast ...")
+		fmt.Println()
+
+		if cfg.ExportMethod != "developer-id" {
+			log.Warnf("Sparkle appcast is only generated for developer-id exports, skipping (export method: %s)", cfg.ExportMethod)
+		} else {
+			item, err := newSparkleAppcastItem(archive, filePath, sparklePrivateKey, cfg.SparkleDownloadURLTemplate, cfg.SparkleReleaseNotesURL, time.Now())
+			if err != nil {
+				failf(failureOutput, "Failed to create Sparkle appcast item, error: %s", err)
+			}
+
+			appcast := newSparkleAppcast(appNameFromArchive(archive))
+			if cfg.SparkleAppcastPath != "" {
+				content, err := fileutil.ReadStringFromFile(cfg.SparkleAppcastPath)
+				if err != nil {
+					failf(failureOutput, "Failed to read appcast (%s), error: %s", cfg.SparkleAppcastPath, err)
+				}
+				appcast = content
+			}
+
+			appcast, err = addSparkleAppcastItem(appcast, item)
+			if err != nil {
+				failf(failureOutput, "Failed to add item to the appcast, error: %s", err)
+			}
+
+			log.Printf("appcast item:")
+			fmt.Println(item.String())
+
+			if err := output.ExportOutputFileContent(appcast, appcastPath, bitriseSparkleAppcastPthEnvKey); err != nil {
+				failf(failureOutput, "Failed to export %s, error: %s", bitriseSparkleAppcastPthEnvKey, err)
+			}
+
+			log.Donef("The appcast path is now available in the Environment Variable: %s (value: %s)", bitriseSparkleAppcastPthEnvKey, appcastPath)
+			addArtifact(appcastPath, bitriseSparkleAppcastPthEnvKey)
+		}
+	}
+
+	// Homebrew cask
+	if cfg.IsGenerateHomebrewCask == "yes" {
+		fmt.Println()
+		log.Infof("Generating Homebrew cask ...")
+		fmt.Println()
+
+		if cfg.ExportMethod != "developer-id" {
+			log.Warnf("Homebrew cask is only generated for developer-id exports, skipping (export method: %s)", cfg.ExportMethod)
+		} else if ext := filepath.Ext(filePath); ext != ".zip" && ext != ".dmg" {
+			log.Warnf("Homebrew cask can only be generated for zip or dmg artifacts, skipping (artifact: %s)", filePath)
+		} else {
+			if cfg.HomebrewCaskURLTemplate == "" {
+				failf(failureInput, "Homebrew cask URL template is required to generate the cask")
+			}
+
+			cask, err := newHomebrewCask(archive, filePath, cfg.HomebrewCaskToken, cfg.HomebrewCaskURLTemplate, cfg.HomebrewCaskHomepage)
+			if err != nil {
+				failf(failureOutput, "Failed to create Homebrew cask, error: %s", err)
+			}
+
+			log.Printf("cask:")
+			fmt.Println(cask.String())
+
+			caskPath := filepath.Join(cfg.OutputDir, cask.Token+".rb")
+			if err := output.ExportOutputFileContent(cask.String(), caskPath, bitriseHomebrewCaskPthEnvKey); err != nil {
+				failf(failureOutput, "Failed to export %s, error: %s", bitriseHomebrewCaskPthEnvKey, err)
+			}
+
+			log.Donef("The cask path is now available in the Environment Variable: %s (value: %s)", bitriseHomebrewCaskPthEnvKey, caskPath)
+			addArtifact(caskPath, bitriseHomebrewCaskPthEnvKey)
+		}
+	}
+
+	// Archive report
+	fmt.Println()
+	log.Infof("Writing archive report ...")
+	fmt.Println()
+
+	report, err := newArchiveReport().json()
+	if err != nil {
+		failf(failureOutput, "Failed to serialize the archive report, error: %s", err)
+	}
+	if err := output.ExportOutputFileContent(report, archiveReportPath, bitriseArchiveReportPthEnvKey); err != nil {
+		failf(failureOutput, "Failed to export %s, error: %s", bitriseArchiveReportPthEnvKey, err)
+	}
+
+	log.Donef("The archive report path is now available in the Environment Variable: %s (value: %s)", bitriseArchiveReportPthEnvKey, archiveReportPath)
+	addArtifact(archiveReportPath, bitriseArchiveReportPthEnvKey)
+
+	// Provenance
+	if cfg.IsGenerateProvenance == "yes" {
+		fmt.Println()
+		log.Infof("Generating build provenance ...")
+		fmt.Println()
+
+		signing := provenanceSigning{
+			ArchiveIdentity:     identity,
+			ArchiveProfileUUIDs: map[string]string{},
+		}
+		for bundleID, profile := range archive.BundleIDProfileInfoMap() {
+			signing.ArchiveProfileUUIDs[bundleID] = profile.UUID
+		}
+		if exportCodeSignGroup != nil {
+			signing.ExportIdentity = exportCodeSignGroup.Certificate().CommonName
+			if installerCertificate := exportCodeSignGroup.InstallerCertificate(); installerCertificate != nil {
+				signing.ExportInstallerIdentity = installerCertificate.CommonName
+			}
+			signing.ExportProfileUUIDs = map[string]string{}
+			for bundleID, profile := range exportCodeSignGroup.BundleIDProfileMap() {
+				signing.ExportProfileUUIDs[bundleID] = profile.UUID
+			}
+		}
+
+		builderID := os.Getenv("BITRISE_APP_URL")
+		if builderID == "" {
+			builderID = "https://github.com/bitrise-steplib/steps-xcode-archive-mac"
+		}
+
+		// The free-form inputs were validated before archiving
+		inputBuildSettings, _ := parseBuildSettings(cfg.BuildSettings)
+		xcodebuildOptions, _ := splitXcodebuildOptions(cfg.XcodebuildOptions)
+
+		statement := newProvenanceStatement(indexedArtifacts(), provenanceParams{
+			Inputs:            redactedInputs(cfg),
+			XcodeVersion:      xcodebuildVersion.Version,
+			XcodeBuildVersion: xcodebuildVersion.BuildVersion,
+			Commands:          redactCommands(executedCommands, inputBuildSettings, xcodebuildOptions, secretInputValues(cfg)),
+			Signing:           signing,
+			Source:            gitSource(filepath.Dir(cfg.ProjectPath)),
+			BuilderID:         builderID,
+			InvocationID:      os.Getenv("BITRISE_BUILD_URL"),
+			StartedOn:         startTime,
+			FinishedOn:        time.Now(),
+		})
+
+		envelope, err := signProvenanceStatement(statement, provenanceSigningKey)
+		if err != nil {
+			failf(failureOutput, "Failed to sign provenance, error: %s", err)
+		}
+
+		content, err := json.Marshal(envelope)
+		if err != nil {
+			failf(failureOutput, "Failed to encode provenance, error: %s", err)
+		}
+
+		provenancePath := filepath.Join(cfg.OutputDir, cfg.ArtifactName+".intoto.jsonl")
+		if err := output.ExportOutputFileContent(string(content)+"\n", provenancePath, bitriseProvenancePthEnvKey); err != nil {
+			failf(failureOutput, "Failed to export %s, error: %s", bitriseProvenancePthEnvKey, err)
+		}
+
+		log.Printf("subjects:")
+		for _, subject := range statement.Subject {
+			log.Printf("- %s (sha256: %s)", subject.Name, subject.Digest["sha256"])
+		}
+		log.Printf("signing key ID: %s", envelope.Signatures[0].KeyID)
+
+		log.Donef("The provenance path is now available in the Environment Variable: %s (value: %s)", bitriseProvenancePthEnvKey, provenancePath)
+		addArtifact(provenancePath, bitriseProvenancePthEnvKey)
+	}
+
+	stepLifecycle.exit(nil)
 }
 
 type ArchiveCommandOpts struct {
-	IsCleanBuild string
+	IsCleanBuild    bool
+	DerivedDataPath string
 
 	ProjectPath   string
 	IsWorkspace   bool
@@ -752,27 +1841,30 @@ type ArchiveCommandOpts struct {
 	ForceProvisioningProfile          string
 	ForceCodeSignIdentity             string
 
-	ArchivePath       string
-	XcodebuildOptions string
+	ArchivePath               string
+	XcodebuildOptions         string
+	DisableIndexWhileBuilding bool
+	PackageOptions            []string
+	BuildSettings             []buildSetting
+	XCConfigPath              string
+	ResultBundlePath          string
 }
 
-func createArchiveCmd(opts ArchiveCommandOpts) *xcodebuild.CommandBuilder {
-	actions := []string{"archive"}
-	if opts.IsCleanBuild == "yes" {
+func createArchiveCmd(opts ArchiveCommandOpts) (*xcodebuild.CommandBuilder, error) {
+	// xcodebuild performs the actions in the given order, the clean has to precede the archive.
+	var actions []string
+	if opts.IsCleanBuild {
 		actions = append(actions, "clean")
 	}
+	actions = append(actions, "archive")
 
 	archiveCmd := xcodebuild.NewCommandBuilder(opts.ProjectPath, actions...)
 	archiveCmd.SetScheme(opts.Scheme)
 	archiveCmd.SetConfiguration(opts.Configuration)
 
-	var customOptions []string
-	if opts.XcodebuildOptions != "" {
-		userOptions, err := shellquote.Split(opts.XcodebuildOptions)
-		if err != nil {
-			failf("Failed to shell split XcodebuildOptions (%s), error: %s", opts.XcodebuildOptions)
-		}
-		customOptions = userOptions
+	customOptions, err := splitXcodebuildOptions(opts.XcodebuildOptions)
+	if err != nil {
+		return nil, err
 	}
 
 	if !sliceutil.IsStringInSlice("-destination", customOptions) {
@@ -795,10 +1887,28 @@ func createArchiveCmd(opts ArchiveCommandOpts) *xcodebuild.CommandBuilder {
 		log.Printf("Forcing Code Signing Identity: %s", opts.ForceCodeSignIdentity)
 		customOptions = append(customOptions, fmt.Sprintf("CODE_SIGN_IDENTITY=%s", opts.ForceCodeSignIdentity))
 	}
+	if opts.DisableIndexWhileBuilding {
+		customOptions = append(customOptions, "COMPILER_INDEX_STORE_ENABLE=NO")
+	}
+	for _, setting := range opts.BuildSettings {
+		customOptions = append(customOptions, setting.String())
+	}
+	customOptions = append(customOptions, opts.PackageOptions...)
+	if opts.DerivedDataPath != "" {
+		customOptions = append(customOptions, "-derivedDataPath", opts.DerivedDataPath)
+	}
 
 	archiveCmd.SetCustomOptions(customOptions)
 
 	archiveCmd.SetArchivePath(opts.ArchivePath)
 
-	return archiveCmd
+	if opts.XCConfigPath != "" {
+		archiveCmd.SetXCConfigPath(opts.XCConfigPath)
+	}
+
+	if opts.ResultBundlePath != "" {
+		archiveCmd.SetResultBundlePath(opts.ResultBundlePath)
+	}
+
+	return archiveCmd, nil
 }
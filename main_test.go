@@ -1,8 +1,12 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/bitrise-io/go-utils/command"
 )
 
 func TestWhenForceTeamIDSpecifiedTheCreateArchiveCmdAddsDEVELOPMENT_TEAM(t *testing.T) {
@@ -10,10 +14,132 @@ func TestWhenForceTeamIDSpecifiedTheCreateArchiveCmdAddsDEVELOPMENT_TEAM(t *test
 		ForceTeamID: "ABCD",
 	}
 
-	cmd := createArchiveCmd(opts)
+	cmd, err := createArchiveCmd(opts)
+	if err != nil {
+		t.Fatalf("createArchiveCmd() error = %s", err)
+	}
 	got := cmd.PrintableCmd()
 	want := `xcodebuild "archive" "-destination" "generic/platform=macOS" "DEVELOPMENT_TEAM=ABCD"`
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("createArchiveCmd() = %v, want %v", got, want)
 	}
 }
+
+func TestCreateArchiveCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ArchiveCommandOpts
+		want string
+	}{
+		{
+			name: "workspace with index store disabled and package options",
+			opts: ArchiveCommandOpts{
+				ProjectPath:               "/work/App.xcworkspace",
+				IsWorkspace:               true,
+				Scheme:                    "App",
+				Configuration:             "Release",
+				ArchivePath:               "/tmp/App.xcarchive",
+				DisableIndexWhileBuilding: true,
+				PackageOptions:            []string{"-clonedSourcePackagesDirPath", "/cache/spm", "-onlyUsePackageVersionsFromResolvedFile"},
+			},
+			want: `xcodebuild "archive" "-workspace" "/work/App.xcworkspace" "-scheme" "App" "-configuration" "Release" "-archivePath" "/tmp/App.xcarchive" "-destination" "generic/platform=macOS" "COMPILER_INDEX_STORE_ENABLE=NO" "-clonedSourcePackagesDirPath" "/cache/spm" "-onlyUsePackageVersionsFromResolvedFile"`,
+		},
+		{
+			name: "build settings and xcconfig",
+			opts: ArchiveCommandOpts{
+				ProjectPath:   "/work/App.xcodeproj",
+				Scheme:        "App",
+				ArchivePath:   "/tmp/App.xcarchive",
+				XCConfigPath:  "/work/Release.xcconfig",
+				BuildSettings: []buildSetting{{Key: "SWIFT_ACTIVE_COMPILATION_CONDITIONS", Value: "RELEASE CI"}},
+			},
+			want: `xcodebuild "archive" "-project" "/work/App.xcodeproj" "-scheme" "App" "-xcconfig" "/work/Release.xcconfig" "-archivePath" "/tmp/App.xcarchive" "-destination" "generic/platform=macOS" "SWIFT_ACTIVE_COMPILATION_CONDITIONS=RELEASE CI"`,
+		},
+		{
+			name: "result bundle",
+			opts: ArchiveCommandOpts{
+				ProjectPath:      "/work/App.xcodeproj",
+				Scheme:           "App",
+				ArchivePath:      "/tmp/App.xcarchive",
+				ResultBundlePath: "/tmp/App.xcresult",
+			},
+			want: `xcodebuild "archive" "-project" "/work/App.xcodeproj" "-scheme" "App" "-archivePath" "/tmp/App.xcarchive" "-resultBundlePath" "/tmp/App.xcresult" "-destination" "generic/platform=macOS"`,
+		},
+		{
+			name: "clean build with derived data path",
+			opts: ArchiveCommandOpts{
+				IsCleanBuild:    true,
+				DerivedDataPath: "/cache/DerivedData",
+				ProjectPath:     "/work/App.xcodeproj",
+				Scheme:          "App",
+				ArchivePath:     "/tmp/App.xcarchive",
+			},
+			want: `xcodebuild "clean" "archive" "-project" "/work/App.xcodeproj" "-scheme" "App" "-archivePath" "/tmp/App.xcarchive" "-destination" "generic/platform=macOS" "-derivedDataPath" "/cache/DerivedData"`,
+		},
+		{
+			name: "project with custom destination",
+			opts: ArchiveCommandOpts{
+				ProjectPath:       "/work/App.xcodeproj",
+				Scheme:            "App",
+				ArchivePath:       "/tmp/App.xcarchive",
+				XcodebuildOptions: `-destination "platform=macOS,arch=x86_64"`,
+			},
+			want: `xcodebuild "archive" "-project" "/work/App.xcodeproj" "-scheme" "App" "-archivePath" "/tmp/App.xcarchive" "-destination" "platform=macOS,arch=x86_64"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := createArchiveCmd(tt.opts)
+			if err != nil {
+				t.Fatalf("createArchiveCmd() error = %s", err)
+			}
+			if got := cmd.PrintableCmd(); got != tt.want {
+				t.Errorf("createArchiveCmd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnterWorkDir(t *testing.T) {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(originalDir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	workDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := enterWorkDir(workDir)
+	if err != nil {
+		t.Fatalf("enterWorkDir() error = %s", err)
+	}
+	if got != workDir {
+		t.Errorf("enterWorkDir() = %v, want %v", got, workDir)
+	}
+
+	// Spawned commands inherit the working directory
+	out, err := command.New("pwd").RunAndReturnTrimmedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != workDir {
+		t.Errorf("command ran in %s, want %s", out, workDir)
+	}
+
+	if _, err := enterWorkDir(filepath.Join(workDir, "missing")); err == nil {
+		t.Errorf("enterWorkDir() expected error for a missing directory")
+	}
+}
+
+func TestCreateArchiveCmdInvalidXcodebuildOptions(t *testing.T) {
+	if _, err := createArchiveCmd(ArchiveCommandOpts{XcodebuildOptions: `-destination "platform=macOS`}); err == nil {
+		t.Errorf("createArchiveCmd() expected error for unterminated quote")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/tools"
+)
+
+// The measured phases of the Step, in the order of the run.
+const (
+	phaseXcprettySetup      = "xcpretty-setup"
+	phaseArchive            = "archive"
+	phaseXCArchiveParsing   = "xcarchive-parsing"
+	phaseCodeSignResolution = "code-sign-resolution"
+	phaseExport             = "export"
+	phaseDSYMCollection     = "dsym-collection"
+	phaseZip                = "zip"
+)
+
+// stepMetrics collects the phase durations of the Step run, zipping is measured by every zipAndExportOutput call.
+var stepMetrics = &phaseMetrics{}
+
+// phaseMetrics is the wall-clock duration of the phases, a phase run multiple times (e.g. zipping) is summed up.
+type phaseMetrics struct {
+	mu     sync.Mutex
+	phases []phaseDuration
+}
+
+type phaseDuration struct {
+	Name     string
+	Duration time.Duration
+	Runs     int
+}
+
+// measure records the duration of the phase since started, use it as `defer stepMetrics.measure(phase, time.Now())`.
+func (m *phaseMetrics) measure(phase string, started time.Time) {
+	m.add(phase, time.Since(started))
+}
+
+func (m *phaseMetrics) add(phase string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.phases {
+		if m.phases[i].Name == phase {
+			m.phases[i].Duration += d
+			m.phases[i].Runs++
+			return
+		}
+	}
+	m.phases = append(m.phases, phaseDuration{Name: phase, Duration: d, Runs: 1})
+}
+
+func (m *phaseMetrics) snapshot() []phaseDuration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]phaseDuration{}, m.phases...)
+}
+
+// phaseDurationEnvKey returns the Environment Variable of the phase duration, e.g. BITRISE_CODE_SIGN_RESOLUTION_DURATION.
+func phaseDurationEnvKey(phase string) string {
+	return "BITRISE_" + strings.ToUpper(strings.ReplaceAll(phase, "-", "_")) + "_DURATION"
+}
+
+// roundedSeconds returns the duration in seconds, rounded to milliseconds.
+func roundedSeconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+// stepMetricsReport is the step-metrics.json artifact.
+type stepMetricsReport struct {
+	TotalSeconds float64        `json:"totalSeconds"`
+	Phases       []phaseSeconds `json:"phases"`
+}
+
+type phaseSeconds struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Runs    int     `json:"runs"`
+}
+
+// json returns the step-metrics.json of the phases measured so far.
+func (m *phaseMetrics) json(total time.Duration) (string, error) {
+	report := stepMetricsReport{TotalSeconds: roundedSeconds(total), Phases: []phaseSeconds{}}
+	for _, phase := range m.snapshot() {
+		report.Phases = append(report.Phases, phaseSeconds{Name: phase.Name, Seconds: roundedSeconds(phase.Duration), Runs: phase.Runs})
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// summaryTable returns the phases with their duration and share of the total duration.
+func (m *phaseMetrics) summaryTable(total time.Duration) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Phase\tDuration\tShare\tRuns")
+	for _, phase := range m.snapshot() {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(phase.Duration) / float64(total)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%d\n", phase.Name, phase.Duration.Round(time.Millisecond), share, phase.Runs)
+	}
+	fmt.Fprintf(w, "total\t%s\t\t\n", total.Round(time.Millisecond))
+	if err := w.Flush(); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// exportDurations exports the duration of every measured phase in seconds.
+func (m *phaseMetrics) exportDurations() error {
+	for _, phase := range m.snapshot() {
+		seconds := strconv.FormatFloat(roundedSeconds(phase.Duration), 'f', -1, 64)
+		if err := tools.ExportEnvironmentWithEnvman(phaseDurationEnvKey(phase.Name), seconds); err != nil {
+			return fmt.Errorf("failed to export %s: %s", phaseDurationEnvKey(phase.Name), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseMetricsJSON(t *testing.T) {
+	m := &phaseMetrics{}
+	m.add(phaseArchive, 90*time.Second)
+	m.add(phaseZip, 1500*time.Millisecond)
+	m.add(phaseExport, 20*time.Second)
+	m.add(phaseZip, 2500*time.Millisecond)
+
+	got, err := m.json(2 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+  "totalSeconds": 120,
+  "phases": [
+    {
+      "name": "archive",
+      "seconds": 90,
+      "runs": 1
+    },
+    {
+      "name": "zip",
+      "seconds": 4,
+      "runs": 2
+    },
+    {
+      "name": "export",
+      "seconds": 20,
+      "runs": 1
+    }
+  ]
+}
+`
+	if got != want {
+		t.Errorf("json() = %s, want %s", got, want)
+	}
+}
+
+func TestPhaseMetricsSummaryTable(t *testing.T) {
+	m := &phaseMetrics{}
+	m.add(phaseArchive, 75*time.Second)
+	m.add(phaseDSYMCollection, 250*time.Millisecond)
+
+	got := m.summaryTable(100 * time.Second)
+
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	var rows [][]string
+	for _, line := range lines {
+		rows = append(rows, strings.Fields(line))
+	}
+	want := [][]string{
+		{"Phase", "Duration", "Share", "Runs"},
+		{"archive", "1m15s", "75.0%", "1"},
+		{"dsym-collection", "250ms", "0.2%", "1"},
+		{"total", "1m40s"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("summaryTable() = \n%s, want rows %v", got, want)
+	}
+}
+
+func TestPhaseDurationEnvKey(t *testing.T) {
+	for phase, want := range map[string]string{
+		phaseXcprettySetup:      "BITRISE_XCPRETTY_SETUP_DURATION",
+		phaseCodeSignResolution: "BITRISE_CODE_SIGN_RESOLUTION_DURATION",
+		phaseZip:                "BITRISE_ZIP_DURATION",
+	} {
+		if got := phaseDurationEnvKey(phase); got != want {
+			t.Errorf("phaseDurationEnvKey(%s) = %s, want %s", phase, got, want)
+		}
+	}
+}
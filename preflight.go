@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/errorutil"
+	"github.com/bitrise-io/go-xcode/exportoptions"
+	"github.com/bitrise-io/go-xcode/profileutil"
+	"github.com/bitrise-io/go-xcode/xcodebuild"
+	"github.com/bitrise-io/go-xcode/xcodeproject/serialized"
+	glob "github.com/ryanuber/go-glob"
+)
+
+var buildSettingsTargetPattern = regexp.MustCompile(`^Build settings for action \S+ and target "?(.+?)"?:$`)
+
+// targetBuildSettings holds the build settings of a target, as printed by `xcodebuild -showBuildSettings`.
+type targetBuildSettings struct {
+	Target   string
+	Settings serialized.Object
+}
+
+func (t targetBuildSettings) setting(key string) string {
+	value, _ := t.Settings.String(key)
+	return value
+}
+
+// isSigned returns true for the app and app extension targets, the targets which need a provisioning profile.
+func (t targetBuildSettings) isSigned() bool {
+	wrapperExtension := t.setting("WRAPPER_EXTENSION")
+	return wrapperExtension == "app" || wrapperExtension == "appex"
+}
+
+// preflightOpts are the Step inputs the project's build settings are validated against.
+type preflightOpts struct {
+	Configuration                     string
+	ExportMethod                      string
+	ForceCodeSignIdentity             string
+	ForceProvisioningProfileSpecifier string
+	ForceProvisioningProfile          string
+	// CheckProfiles is false if the installed profiles were not loaded, e.g. the export options are custom.
+	CheckProfiles bool
+}
+
+// readTargetBuildSettings runs `xcodebuild -showBuildSettings` for the scheme and returns the build settings of every target.
+// The xcconfig and the build settings of the archive command are applied, so the settings match the ones of the archive.
+func readTargetBuildSettings(projectPath, scheme, configuration, xcconfigPath string, settings []buildSetting) ([]targetBuildSettings, error) {
+	customOptions := []string{"-destination", "generic/platform=macOS"}
+	if xcconfigPath != "" {
+		customOptions = append(customOptions, "-xcconfig", xcconfigPath)
+	}
+	for _, setting := range settings {
+		customOptions = append(customOptions, setting.String())
+	}
+
+	showBuildSettingsCmd := xcodebuild.NewShowBuildSettingsCommand(projectPath)
+	showBuildSettingsCmd.SetScheme(scheme)
+	showBuildSettingsCmd.SetConfiguration(configuration)
+	showBuildSettingsCmd.SetCustomOptions(customOptions)
+
+	cmd := showBuildSettingsCmd.Command()
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		if errorutil.IsExitStatusError(err) {
+			return nil, fmt.Errorf("%s failed, output: %s", showBuildSettingsCmd.PrintableCmd(), out)
+		}
+		return nil, fmt.Errorf("failed to run command %s: %s", showBuildSettingsCmd.PrintableCmd(), err)
+	}
+
+	return parseTargetBuildSettings(out)
+}
+
+// parseTargetBuildSettings parses the per target sections of the `xcodebuild -showBuildSettings` output.
+func parseTargetBuildSettings(out string) ([]targetBuildSettings, error) {
+	var targets []targetBuildSettings
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := buildSettingsTargetPattern.FindStringSubmatch(line); match != nil {
+			targets = append(targets, targetBuildSettings{
+				Target:   match[1],
+				Settings: serialized.Object{},
+			})
+			continue
+		}
+
+		if len(targets) == 0 {
+			continue
+		}
+
+		if split := strings.SplitN(line, " = ", 2); len(split) == 2 {
+			targets[len(targets)-1].Settings[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no target build settings found in the output")
+	}
+
+	return targets, nil
+}
+
+// preflightProblems validates the targets' build settings and returns every problem found.
+func preflightProblems(targets []targetBuildSettings, opts preflightOpts, installedProfiles []profileutil.ProvisioningProfileInfoModel) []string {
+	var problems []string
+
+	var exportMethod exportoptions.Method
+	if opts.ExportMethod != "none" {
+		method, err := exportoptions.ParseMethod(opts.ExportMethod)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid export method: %s", opts.ExportMethod))
+		}
+		exportMethod = method
+	}
+
+	isProfileForced := opts.ForceProvisioningProfileSpecifier != "" || opts.ForceProvisioningProfile != ""
+	isIdentityForced := strings.Contains(opts.ForceCodeSignIdentity, ":")
+
+	for _, target := range targets {
+		if opts.Configuration != "" {
+			if configuration := target.setting("CONFIGURATION"); configuration != opts.Configuration {
+				problems = append(problems, fmt.Sprintf("%s: configuration %s does not exist, xcodebuild would use %s instead", target.Target, opts.Configuration, configuration))
+			}
+		}
+
+		if platform := target.setting("PLATFORM_NAME"); platform != "" && platform != "macosx" {
+			problems = append(problems, fmt.Sprintf("%s: SDKROOT is %s (platform: %s), expected macosx", target.Target, target.setting("SDKROOT"), platform))
+		}
+
+		if !target.isSigned() {
+			continue
+		}
+
+		bundleID := target.setting("PRODUCT_BUNDLE_IDENTIFIER")
+		isAutomatic := target.setting("CODE_SIGN_STYLE") == "Automatic"
+
+		if isAutomatic && isProfileForced {
+			problems = append(problems, fmt.Sprintf("%s: uses automatic signing (CODE_SIGN_STYLE = Automatic), but a provisioning profile is forced, use manual signing or remove the force_provisioning_profile* inputs", target.Target))
+		}
+		if isAutomatic && isIdentityForced {
+			problems = append(problems, fmt.Sprintf("%s: uses automatic signing (CODE_SIGN_STYLE = Automatic), but a specific code sign identity (%s) is forced, force a code sign group (e.g. Apple Development) instead", target.Target, opts.ForceCodeSignIdentity))
+		}
+
+		if isAutomatic || exportMethod == "" || bundleID == "" || !opts.CheckProfiles {
+			continue
+		}
+
+		// Developer ID apps can be signed manually without a provisioning profile.
+		hasProfile := isProfileForced || target.setting("PROVISIONING_PROFILE_SPECIFIER") != "" || target.setting("PROVISIONING_PROFILE") != ""
+		if exportMethod == exportoptions.MethodDeveloperID && !hasProfile {
+			continue
+		}
+
+		if !hasMatchingProfile(installedProfiles, bundleID, exportMethod) {
+			problems = append(problems, fmt.Sprintf("%s: no installed %s provisioning profile found for bundle ID %s", target.Target, exportMethod, bundleID))
+		}
+	}
+
+	return problems
+}
+
+func hasMatchingProfile(profiles []profileutil.ProvisioningProfileInfoModel, bundleID string, exportMethod exportoptions.Method) bool {
+	for _, profile := range profiles {
+		if profile.ExportType == exportMethod && glob.Glob(profile.BundleID, bundleID) {
+			return true
+		}
+	}
+	return false
+}
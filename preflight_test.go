@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-xcode/exportoptions"
+	"github.com/bitrise-io/go-xcode/profileutil"
+	"github.com/bitrise-io/go-xcode/xcodeproject/serialized"
+)
+
+const showBuildSettingsOutput = `Command line invocation:
+    /Applications/Xcode.app/Contents/Developer/usr/bin/xcodebuild -project App.xcodeproj -scheme App -showBuildSettings
+
+Build settings for action build and target App:
+    CODE_SIGN_STYLE = Manual
+    CONFIGURATION = Release
+    OTHER_LDFLAGS = -framework = Foo
+    PLATFORM_NAME = macosx
+    PRODUCT_BUNDLE_IDENTIFIER = io.bitrise.app
+    WRAPPER_EXTENSION = app
+
+Build settings for action build and target Widget:
+    CODE_SIGN_STYLE = Automatic
+    CONFIGURATION = Release
+    PLATFORM_NAME = macosx
+    PRODUCT_BUNDLE_IDENTIFIER = io.bitrise.app.widget
+    WRAPPER_EXTENSION = appex
+`
+
+func TestParseTargetBuildSettings(t *testing.T) {
+	got, err := parseTargetBuildSettings(showBuildSettingsOutput)
+	if err != nil {
+		t.Fatalf("parseTargetBuildSettings() error = %s", err)
+	}
+
+	want := []targetBuildSettings{
+		{
+			Target: "App",
+			Settings: serialized.Object{
+				"CODE_SIGN_STYLE":           "Manual",
+				"CONFIGURATION":             "Release",
+				"OTHER_LDFLAGS":             "-framework = Foo",
+				"PLATFORM_NAME":             "macosx",
+				"PRODUCT_BUNDLE_IDENTIFIER": "io.bitrise.app",
+				"WRAPPER_EXTENSION":         "app",
+			},
+		},
+		{
+			Target: "Widget",
+			Settings: serialized.Object{
+				"CODE_SIGN_STYLE":           "Automatic",
+				"CONFIGURATION":             "Release",
+				"PLATFORM_NAME":             "macosx",
+				"PRODUCT_BUNDLE_IDENTIFIER": "io.bitrise.app.widget",
+				"WRAPPER_EXTENSION":         "appex",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTargetBuildSettings() = %v, want %v", got, want)
+	}
+
+	if _, err := parseTargetBuildSettings("xcodebuild: error: no scheme"); err == nil {
+		t.Errorf("parseTargetBuildSettings() expected error")
+	}
+}
+
+func TestPreflightProblems(t *testing.T) {
+	targets, err := parseTargetBuildSettings(showBuildSettingsOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := []profileutil.ProvisioningProfileInfoModel{
+		{BundleID: "io.bitrise.*", ExportType: exportoptions.MethodDevelopment},
+	}
+
+	if got := preflightProblems(targets, preflightOpts{Configuration: "Release", ExportMethod: "development", CheckProfiles: true}, profiles); len(got) != 0 {
+		t.Errorf("preflightProblems() = %v, want no problems", got)
+	}
+
+	got := preflightProblems(targets, preflightOpts{
+		Configuration:            "Relase",
+		ExportMethod:             "developer-id",
+		ForceProvisioningProfile: "c5be4123-1234-4f9d-9843-0d9be985a068",
+		CheckProfiles:            true,
+	}, profiles)
+	want := []string{
+		"App: configuration Relase does not exist, xcodebuild would use Release instead",
+		"App: no installed developer-id provisioning profile found for bundle ID io.bitrise.app",
+		"Widget: configuration Relase does not exist, xcodebuild would use Release instead",
+		"Widget: uses automatic signing (CODE_SIGN_STYLE = Automatic), but a provisioning profile is forced, use manual signing or remove the force_provisioning_profile* inputs",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preflightProblems() = %v, want %v", got, want)
+	}
+}
+
+func TestPreflightProblemsNonMacOSTarget(t *testing.T) {
+	targets := []targetBuildSettings{{
+		Target:   "App",
+		Settings: serialized.Object{"PLATFORM_NAME": "iphoneos", "SDKROOT": "iphoneos"},
+	}}
+
+	got := preflightProblems(targets, preflightOpts{ExportMethod: "none"}, nil)
+	want := []string{"App: SDKROOT is iphoneos (platform: iphoneos), expected macosx"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preflightProblems() = %v, want %v", got, want)
+	}
+}
+
+func TestPreflightProblemsSkippedProfileCheck(t *testing.T) {
+	targets, err := parseTargetBuildSettings(showBuildSettingsOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("profiles not loaded", func(t *testing.T) {
+		got := preflightProblems(targets, preflightOpts{Configuration: "Release", ExportMethod: "development"}, nil)
+		if len(got) != 0 {
+			t.Errorf("preflightProblems() = %v, want no problems", got)
+		}
+	})
+
+	t.Run("developer-id without provisioning profile", func(t *testing.T) {
+		got := preflightProblems(targets, preflightOpts{Configuration: "Release", ExportMethod: "developer-id", CheckProfiles: true}, nil)
+		if len(got) != 0 {
+			t.Errorf("preflightProblems() = %v, want no problems", got)
+		}
+	})
+
+	t.Run("developer-id with provisioning profile", func(t *testing.T) {
+		withProfile := []targetBuildSettings{{
+			Target: "App",
+			Settings: serialized.Object{
+				"CODE_SIGN_STYLE":                "Manual",
+				"PRODUCT_BUNDLE_IDENTIFIER":      "io.bitrise.app",
+				"PROVISIONING_PROFILE_SPECIFIER": "App Developer ID",
+				"WRAPPER_EXTENSION":              "app",
+			},
+		}}
+		got := preflightProblems(withProfile, preflightOpts{ExportMethod: "developer-id", CheckProfiles: true}, nil)
+		want := []string{"App: no installed developer-id provisioning profile found for bundle ID io.bitrise.app"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("preflightProblems() = %v, want %v", got, want)
+		}
+	})
+}
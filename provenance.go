@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	inTotoStatementType         = "https://in-toto.io/Statement/v1"
+	slsaProvenancePredicateType = "https://slsa.dev/provenance/v1"
+	provenanceBuildType         = "https://github.com/bitrise-steplib/steps-xcode-archive-mac/provenance/v1"
+	dssePayloadType             = "application/vnd.in-toto+json"
+
+	redactedValue = "[REDACTED]"
+)
+
+// freeFormInputs may carry secrets (e.g. an API key build setting), only their digest is recorded.
+var freeFormInputs = map[string]bool{
+	"xcodebuild_options":                  true,
+	"build_settings":                      true,
+	"custom_export_options_plist_content": true,
+}
+
+// inTotoStatement is an in-toto attestation statement with a SLSA provenance predicate.
+type inTotoStatement struct {
+	Type          string             `json:"_type"`
+	Subject       []inTotoSubject    `json:"subject"`
+	PredicateType string             `json:"predicateType"`
+	Predicate     slsaProvenanceData `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenanceData struct {
+	BuildDefinition slsaBuildDefinition `json:"buildDefinition"`
+	RunDetails      slsaRunDetails      `json:"runDetails"`
+}
+
+type slsaBuildDefinition struct {
+	BuildType            string                   `json:"buildType"`
+	ExternalParameters   map[string]string        `json:"externalParameters"`
+	InternalParameters   provenanceInternals      `json:"internalParameters"`
+	ResolvedDependencies []slsaResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type provenanceInternals struct {
+	XcodeVersion      string `json:"xcodeVersion"`
+	XcodeBuildVersion string `json:"xcodeBuildVersion"`
+	// Commands are the executed commands with the secret-bearing values redacted, see redactCommands.
+	Commands []string          `json:"commands"`
+	Signing  provenanceSigning `json:"signing"`
+}
+
+// provenanceSigning describes the code signing assets used for archiving and exporting the app.
+type provenanceSigning struct {
+	ArchiveIdentity         string            `json:"archiveIdentity,omitempty"`
+	ArchiveProfileUUIDs     map[string]string `json:"archiveProfileUUIDs,omitempty"`
+	ExportIdentity          string            `json:"exportIdentity,omitempty"`
+	ExportInstallerIdentity string            `json:"exportInstallerIdentity,omitempty"`
+	ExportProfileUUIDs      map[string]string `json:"exportProfileUUIDs,omitempty"`
+}
+
+type slsaResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaRunDetails struct {
+	Builder  slsaBuilder       `json:"builder"`
+	Metadata slsaBuildMetadata `json:"metadata"`
+}
+
+type slsaBuilder struct {
+	ID string `json:"id"`
+}
+
+type slsaBuildMetadata struct {
+	InvocationID string    `json:"invocationId,omitempty"`
+	StartedOn    time.Time `json:"startedOn"`
+	FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// dsseEnvelope is a Dead Simple Signing Envelope wrapping the signed statement.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// provenanceSource describes the source revision the Step built.
+type provenanceSource struct {
+	RepositoryURL string
+	Commit        string
+}
+
+// provenanceParams holds everything the Step knows about the build.
+type provenanceParams struct {
+	Inputs            map[string]string
+	XcodeVersion      string
+	XcodeBuildVersion string
+	Commands          []string
+	Signing           provenanceSigning
+	Source            provenanceSource
+	BuilderID         string
+	InvocationID      string
+	StartedOn         time.Time
+	FinishedOn        time.Time
+}
+
+// newProvenanceStatement creates a SLSA provenance statement with the given artifacts as subjects.
+func newProvenanceStatement(artifacts []artifact, params provenanceParams) inTotoStatement {
+	var subjects []inTotoSubject
+	for _, a := range artifacts {
+		subjects = append(subjects, inTotoSubject{
+			Name:   filepath.Base(a.Path),
+			Digest: map[string]string{"sha256": a.SHA256},
+		})
+	}
+
+	var dependencies []slsaResourceDescriptor
+	if params.Source.Commit != "" {
+		uri := params.Source.RepositoryURL
+		if uri != "" && !strings.HasPrefix(uri, "git+") {
+			uri = "git+" + uri
+		}
+		dependencies = append(dependencies, slsaResourceDescriptor{
+			URI:    uri,
+			Digest: map[string]string{"gitCommit": params.Source.Commit},
+		})
+	}
+
+	return inTotoStatement{
+		Type:          inTotoStatementType,
+		Subject:       subjects,
+		PredicateType: slsaProvenancePredicateType,
+		Predicate: slsaProvenanceData{
+			BuildDefinition: slsaBuildDefinition{
+				BuildType:          provenanceBuildType,
+				ExternalParameters: params.Inputs,
+				InternalParameters: provenanceInternals{
+					XcodeVersion:      params.XcodeVersion,
+					XcodeBuildVersion: params.XcodeBuildVersion,
+					Commands:          params.Commands,
+					Signing:           params.Signing,
+				},
+				ResolvedDependencies: dependencies,
+			},
+			RunDetails: slsaRunDetails{
+				Builder: slsaBuilder{ID: params.BuilderID},
+				Metadata: slsaBuildMetadata{
+					InvocationID: params.InvocationID,
+					StartedOn:    params.StartedOn.UTC(),
+					FinishedOn:   params.FinishedOn.UTC(),
+				},
+			},
+		},
+	}
+}
+
+// signProvenanceStatement wraps the statement into a DSSE envelope signed with the given key.
+func signProvenanceStatement(statement inTotoStatement, privateKey ed25519.PrivateKey) (dsseEnvelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return dsseEnvelope{}, err
+	}
+
+	signature := ed25519.Sign(privateKey, dssePreAuthEncoding(dssePayloadType, payload))
+
+	return dsseEnvelope{
+		PayloadType: dssePayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []dsseSignature{{
+			KeyID: ed25519KeyID(privateKey.Public().(ed25519.PublicKey)),
+			Sig:   base64.StdEncoding.EncodeToString(signature),
+		}},
+	}, nil
+}
+
+// dssePreAuthEncoding returns the DSSE v1 pre-authentication encoding, the message actually signed.
+func dssePreAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// ed25519KeyID returns the hex encoded SHA-256 digest of the public key.
+func ed25519KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// gitSource returns the source repository and commit of the build, read from the git-clone Step's outputs
+// or from the git repository of the given directory.
+func gitSource(dir string) provenanceSource {
+	source := provenanceSource{
+		RepositoryURL: os.Getenv("GIT_REPOSITORY_URL"),
+		Commit:        os.Getenv("GIT_CLONE_COMMIT_HASH"),
+	}
+
+	if source.Commit == "" {
+		cmd := command.New("git", "rev-parse", "HEAD").SetDir(dir)
+		if out, err := cmd.RunAndReturnTrimmedOutput(); err == nil {
+			source.Commit = out
+		}
+	}
+	if source.RepositoryURL == "" {
+		cmd := command.New("git", "config", "--get", "remote.origin.url").SetDir(dir)
+		if out, err := cmd.RunAndReturnTrimmedOutput(); err == nil {
+			source.RepositoryURL = out
+		}
+	}
+
+	source.RepositoryURL = redactURLCredentials(source.RepositoryURL)
+	return source
+}
+
+// redactURLCredentials removes the userinfo (e.g. an access token) of a repository URL.
+// scp-like git remotes (git@host:path) have no credentials and are returned as they are.
+func redactURLCredentials(repositoryURL string) string {
+	u, err := url.Parse(repositoryURL)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return repositoryURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// digestValue returns the SHA-256 digest of a value which must not be recorded in the clear.
+func digestValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redactCommands returns the printable commands with the secret-bearing values redacted.
+// The values of the build settings and of the xcodebuild options' flags come from the free-form inputs,
+// they are replaced by their digest; the secret input values are replaced by redactedValue.
+func redactCommands(commands []string, buildSettings []buildSetting, xcodebuildOptions []string, secrets []string) []string {
+	var replacements []string
+	settings := append(append([]buildSetting{}, buildSettings...), xcodebuildOptionBuildSettings(xcodebuildOptions)...)
+	for _, setting := range settings {
+		if setting.Value == "" {
+			continue
+		}
+		redacted := buildSetting{Key: setting.Key, Value: digestValue(setting.Value)}
+		replacements = append(replacements, strconv.Quote(setting.String()), strconv.Quote(redacted.String()))
+	}
+	for i, arg := range xcodebuildOptions {
+		if i > 0 && xcodebuildValueFlags[xcodebuildOptions[i-1]] && arg != "" {
+			replacements = append(replacements, strconv.Quote(arg), strconv.Quote(digestValue(arg)))
+		}
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		// The arguments of the printable commands are quoted, the secret may appear escaped.
+		replacements = append(replacements, secret, redactedValue)
+		if quoted := strconv.Quote(secret); quoted[1:len(quoted)-1] != secret {
+			replacements = append(replacements, quoted[1:len(quoted)-1], redactedValue)
+		}
+	}
+
+	replacer := strings.NewReplacer(replacements...)
+	redacted := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		redacted = append(redacted, replacer.Replace(cmd))
+	}
+	return redacted
+}
+
+// secretInputValues returns the values of the secret inputs of the config.
+func secretInputValues(cfg interface{}) []string {
+	var secrets []string
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		if value := v.Field(i); value.Type() == reflect.TypeOf(stepconf.Secret("")) && value.String() != "" {
+			secrets = append(secrets, value.String())
+		}
+	}
+	return secrets
+}
+
+// parseEd25519PrivateKey parses a PEM encoded PKCS #8 ed25519 private key,
+// or a base64 encoded raw key (see parseSparklePrivateKey).
+func parseEd25519PrivateKey(key string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil {
+		return parseSparklePrivateKey(key)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS #8 private key: %s", err)
+	}
+
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 private key: %T", parsed)
+	}
+	return privateKey, nil
+}
+
+// redactedInputs returns the Step inputs of the config keyed by their input name, with the secret values redacted
+// and the free-form inputs replaced by their digest.
+func redactedInputs(cfg interface{}) map[string]string {
+	inputs := map[string]string{}
+
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		value := v.Field(i)
+		if value.Type() == reflect.TypeOf(stepconf.Secret("")) {
+			if value.String() != "" {
+				inputs[name] = redactedValue
+			} else {
+				inputs[name] = ""
+			}
+			continue
+		}
+		if freeFormInputs[name] {
+			inputs[name] = digestValue(value.String())
+			continue
+		}
+		inputs[name] = fmt.Sprint(value.Interface())
+	}
+
+	return inputs
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// archiveReport describes how the archive was built.
+type archiveReport struct {
+	ProjectPath   string         `json:"projectPath"`
+	Scheme        string         `json:"scheme"`
+	Configuration string         `json:"configuration,omitempty"`
+	XcodeVersion  string         `json:"xcodeVersion"`
+	XCConfigPath  string         `json:"xcconfigPath,omitempty"`
+	BuildSettings []buildSetting `json:"buildSettings"`
+	Commands      []string       `json:"commands"`
+	// XCResult is the summary of the archive action's result bundle, if available.
+	XCResult *xcresultSummary `json:"xcresult,omitempty"`
+}
+
+func (r archiveReport) json() (string, error) {
+	if r.BuildSettings == nil {
+		r.BuildSettings = []buildSetting{}
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const retryInitialBackoff = 10 * time.Second
+
+// transientSignature is an xcodebuild output pattern of a failure worth retrying, e.g. a network error.
+type transientSignature struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// networkCause matches the network errors of xcodebuild, git and NSURLSession.
+const networkCause = `(NSURLErrorDomain|network connection was lost|Internet connection appears to be offline|Could not connect to the server|Could not resolve host|Failed to connect to|Connection reset by peer|unable to access|SSL_ERROR|early EOF|RPC failed|timed out)`
+
+// defaultTransientSignatures are always retried, the transient_failure_patterns input extends them.
+var defaultTransientSignatures = []transientSignature{
+	{
+		Name:    "package resolution network error",
+		Pattern: regexp.MustCompile(`(?s)Could not resolve package dependencies.*` + networkCause),
+	},
+	{
+		Name:    "distribution network error",
+		Pattern: regexp.MustCompile(`(?s)The operation couldn.t be completed\. \(IDEDistribution.*` + networkCause),
+	},
+	{
+		Name:    "timeout",
+		Pattern: regexp.MustCompile(`(?i)(the request timed out|operation timed out|connection timed out|timed out waiting for)`),
+	},
+}
+
+// parseTransientSignatures parses the transient_failure_patterns input, one regular expression per line.
+func parseTransientSignatures(s string) ([]transientSignature, error) {
+	var signatures []transientSignature
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transient failure pattern (%s): %s", line, err)
+		}
+		signatures = append(signatures, transientSignature{Name: line, Pattern: pattern})
+	}
+	return signatures, nil
+}
+
+// retryPolicy retries the commands failing with a transient signature, waiting twice as long before every retry.
+type retryPolicy struct {
+	Retries    int
+	Signatures []transientSignature
+	Backoff    time.Duration
+	Sleep      func(time.Duration)
+}
+
+// transientSignature returns the name of the transient signature of the failure, or an empty string if it is not transient.
+// A hang of the watchdog and an interruption of the Step are not transient: a hanging xcodebuild tends to hang again,
+// and retrying it would multiply the time until the Step fails.
+func (p retryPolicy) transientSignature(out string, err error) string {
+	if stepLifecycle.isInterrupted() {
+		return ""
+	}
+	if _, ok := err.(*hangError); ok {
+		return ""
+	}
+	for _, signature := range p.Signatures {
+		if signature.Pattern.MatchString(out) {
+			return signature.Name
+		}
+	}
+	return ""
+}
+
+// run runs the attempt until it succeeds, fails with a non-transient error or the retries are used up.
+// It returns the output of every attempt and the number of retries.
+func (p retryPolicy) run(phase string, attempt func() (string, error)) (string, int, error) {
+	var outputs []string
+	backoff := p.Backoff
+
+	for retries := 0; ; retries++ {
+		out, err := attempt()
+		if retries > 0 {
+			out = fmt.Sprintf("=== Attempt %d/%d ===\n%s", retries+1, p.Retries+1, out)
+		}
+		outputs = append(outputs, out)
+		allOutput := strings.Join(outputs, "\n")
+
+		if err == nil {
+			if retries > 0 {
+				log.Donef("%s succeeded at attempt %d/%d", phase, retries+1, p.Retries+1)
+			}
+			return allOutput, retries, nil
+		}
+
+		signature := p.transientSignature(out, err)
+		if signature == "" || retries >= p.Retries {
+			if _, isHang := err.(*hangError); retries > 0 && !isHang {
+				err = fmt.Errorf("%s, after %d attempt(s)", err, retries+1)
+			}
+			return allOutput, retries, err
+		}
+
+		fmt.Println()
+		log.Warnf("%s failed with a transient error (%s), attempt %d/%d, retrying in %s ...", phase, signature, retries+1, p.Retries+1, backoff)
+		p.Sleep(backoff)
+		backoff *= 2
+	}
+}
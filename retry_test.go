@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyTransientSignature(t *testing.T) {
+	policy := retryPolicy{Signatures: defaultTransientSignatures}
+
+	tests := []struct {
+		name string
+		out  string
+		err  error
+		want string
+	}{
+		{
+			name: "package resolution network error",
+			out: `xcodebuild: error: Could not resolve package dependencies:
+  Failed to clone repository https://github.com/sparkle-project/Sparkle:
+    fatal: unable to access 'https://github.com/sparkle-project/Sparkle/': Could not resolve host: github.com`,
+			want: "package resolution network error",
+		},
+		{
+			name: "package resolution version conflict",
+			out: `xcodebuild: error: Could not resolve package dependencies:
+  Dependencies could not be resolved because root depends on 'sparkle' 3.0.0..<4.0.0.`,
+			want: "",
+		},
+		{
+			name: "distribution network error",
+			out: `error: exportArchive: The operation couldn’t be completed. (IDEDistributionErrorDomain error 3.)
+Error Domain=NSURLErrorDomain Code=-1001 "The request timed out."`,
+			want: "distribution network error",
+		},
+		{
+			name: "compile error",
+			out:  `/work/App/AppDelegate.swift:12:5: error: cannot find 'NSApp' in scope`,
+			want: "",
+		},
+		{
+			name: "watchdog hang",
+			out:  "Operation timed out\n",
+			err:  &hangError{Phase: "export", Reason: "no output for 20m0s"},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err
+			if err == nil {
+				err = fmt.Errorf("exit status 65")
+			}
+			if got := policy.transientSignature(tt.out, err); got != tt.want {
+				t.Errorf("transientSignature() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTransientSignatures(t *testing.T) {
+	signatures, err := parseTransientSignatures("\nerror: Couldn't communicate with a helper application\n  Unable to connect to the notarization service  \n")
+	if err != nil {
+		t.Fatalf("parseTransientSignatures() error = %s", err)
+	}
+	var names []string
+	for _, signature := range signatures {
+		names = append(names, signature.Name)
+	}
+	if want := []string{"error: Couldn't communicate with a helper application", "Unable to connect to the notarization service"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("parseTransientSignatures() = %v, want %v", names, want)
+	}
+
+	if _, err := parseTransientSignatures("timed out ("); err == nil || !strings.Contains(err.Error(), "invalid transient failure pattern") {
+		t.Errorf("parseTransientSignatures() error = %v, want invalid pattern", err)
+	}
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	var waits []time.Duration
+	policy := retryPolicy{
+		Retries:    3,
+		Signatures: defaultTransientSignatures,
+		Backoff:    10 * time.Second,
+		Sleep:      func(d time.Duration) { waits = append(waits, d) },
+	}
+
+	attempts := 0
+	out, retries, err := policy.run("Export", func() (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "The request timed out.\n", fmt.Errorf("exit status 70")
+		}
+		return "** EXPORT SUCCEEDED **\n", nil
+	})
+	if err != nil {
+		t.Fatalf("run() error = %s", err)
+	}
+	if retries != 2 {
+		t.Errorf("retries = %d, want 2", retries)
+	}
+	if want := []time.Duration{10 * time.Second, 20 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+	wantOut := "The request timed out.\n\n=== Attempt 2/4 ===\nThe request timed out.\n\n=== Attempt 3/4 ===\n** EXPORT SUCCEEDED **\n"
+	if out != wantOut {
+		t.Errorf("run() output = %q, want the output of every attempt %q", out, wantOut)
+	}
+}
+
+func TestRetryPolicyRunFailures(t *testing.T) {
+	policy := retryPolicy{Retries: 1, Signatures: defaultTransientSignatures, Sleep: func(time.Duration) {}}
+
+	attempts := 0
+	_, retries, err := policy.run("Archive", func() (string, error) {
+		attempts++
+		return "error: cannot find 'NSApp' in scope\n", fmt.Errorf("exit status 65")
+	})
+	if attempts != 1 || retries != 0 || err == nil || err.Error() != "exit status 65" {
+		t.Errorf("run() = %d attempt(s), %d retries, %v, want a single attempt for a non-transient failure", attempts, retries, err)
+	}
+
+	attempts = 0
+	_, retries, err = policy.run("Archive", func() (string, error) {
+		attempts++
+		return "Operation timed out\n", fmt.Errorf("exit status 65")
+	})
+	if attempts != 2 || retries != 1 || err == nil || err.Error() != "exit status 65, after 2 attempt(s)" {
+		t.Errorf("run() = %d attempt(s), %d retries, %v, want the retries used up", attempts, retries, err)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"howett.net/plist"
+)
+
+const (
+	cycloneDXSpecVersion = "1.5"
+	sbomToolName         = "steps-xcode-archive-mac"
+)
+
+// cycloneDXBOM is a CycloneDX JSON software bill of materials.
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	PURL               string                 `json:"purl,omitempty"`
+	Hashes             []cycloneDXHash        `json:"hashes,omitempty"`
+	ExternalReferences []cycloneDXExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty    `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// sbomParams describes the archived app and where its dependencies are recorded.
+type sbomParams struct {
+	AppName    string
+	AppVersion string
+	BundleID   string
+	// AppPath is the archived .app, its Contents/Frameworks directory is scanned for embedded frameworks and dylibs.
+	AppPath string
+	// ProjectDir is searched for Podfile.lock and Cartfile.resolved.
+	ProjectDir  string
+	PackagePins []packagePin
+	GeneratedAt time.Time
+}
+
+// newCycloneDXBOM lists the Swift packages, CocoaPods, Carthage dependencies and the embedded binaries of the app.
+func newCycloneDXBOM(params sbomParams) (cycloneDXBOM, error) {
+	serialNumber, err := newUUID()
+	if err != nil {
+		return cycloneDXBOM{}, err
+	}
+
+	var components []cycloneDXComponent
+	for _, pin := range params.PackagePins {
+		components = append(components, swiftPackageComponent(pin))
+	}
+
+	pods, err := readPodfileLock(filepath.Join(params.ProjectDir, "Podfile.lock"))
+	if err != nil && !os.IsNotExist(err) {
+		return cycloneDXBOM{}, err
+	}
+	components = append(components, pods...)
+
+	carthageDependencies, err := readCartfileResolved(filepath.Join(params.ProjectDir, "Cartfile.resolved"))
+	if err != nil && !os.IsNotExist(err) {
+		return cycloneDXBOM{}, err
+	}
+	components = append(components, carthageDependencies...)
+
+	embedded, err := embeddedBinaryComponents(filepath.Join(params.AppPath, "Contents", "Frameworks"))
+	if err != nil {
+		return cycloneDXBOM{}, err
+	}
+	components = append(components, embedded...)
+
+	if components == nil {
+		components = []cycloneDXComponent{}
+	}
+
+	return cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: "urn:uuid:" + serialNumber,
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: params.GeneratedAt.UTC().Format(time.RFC3339),
+			Tools: cycloneDXTools{
+				Components: []cycloneDXComponent{{Type: "application", Name: sbomToolName}},
+			},
+			Component: cycloneDXComponent{
+				Type:       "application",
+				BOMRef:     params.BundleID,
+				Name:       params.AppName,
+				Version:    params.AppVersion,
+				Properties: bundleIDProperty(params.BundleID),
+			},
+		},
+		Components: components,
+	}, nil
+}
+
+func bundleIDProperty(bundleID string) []cycloneDXProperty {
+	if bundleID == "" {
+		return nil
+	}
+	return []cycloneDXProperty{{Name: "cdx:apple:bundleIdentifier", Value: bundleID}}
+}
+
+// swiftPackageComponent returns the component of a Swift package, with a pkg:swift purl for the remote packages.
+func swiftPackageComponent(pin packagePin) cycloneDXComponent {
+	version := pin.Version
+	if version == "" {
+		version = pin.Revision
+	}
+
+	component := cycloneDXComponent{
+		Type:       "library",
+		BOMRef:     "swift:" + pin.Identity,
+		Name:       pin.Identity,
+		Version:    version,
+		Properties: []cycloneDXProperty{{Name: "cdx:swift:revision", Value: pin.Revision}},
+	}
+
+	if u, err := url.Parse(pin.Location); err == nil && u.Host != "" {
+		namespace := u.Host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+		component.PURL = fmt.Sprintf("pkg:swift/%s@%s", namespace, version)
+		component.ExternalReferences = []cycloneDXExternalRef{{Type: "vcs", URL: pin.Location}}
+	}
+
+	return component
+}
+
+var podfileLockPodPattern = regexp.MustCompile(`^  - "?([^ "]+) \(([^)]+)\)"?:?$`)
+var podfileLockChecksumPattern = regexp.MustCompile(`^  "?([^:"]+)"?: ([0-9a-f]{40})$`)
+
+// readPodfileLock returns the pods of the Podfile.lock, with the SHA-1 podspec checksums.
+func readPodfileLock(pth string) ([]cycloneDXComponent, error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", pth, err)
+		}
+	}()
+
+	versions := map[string]string{}
+	checksums := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && !strings.HasPrefix(line, " ") {
+			section = strings.TrimSuffix(line, ":")
+			continue
+		}
+
+		switch section {
+		case "PODS":
+			if match := podfileLockPodPattern.FindStringSubmatch(line); match != nil {
+				// Subspecs (Firebase/Core) share the version of their pod.
+				name := strings.Split(match[1], "/")[0]
+				versions[name] = match[2]
+			}
+		case "SPEC CHECKSUMS":
+			if match := podfileLockChecksumPattern.FindStringSubmatch(line); match != nil {
+				checksums[match[1]] = match[2]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var components []cycloneDXComponent
+	for _, name := range names {
+		component := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  "cocoapods:" + name,
+			Name:    name,
+			Version: versions[name],
+			PURL:    fmt.Sprintf("pkg:cocoapods/%s@%s", name, versions[name]),
+		}
+		if checksum, ok := checksums[name]; ok {
+			component.Hashes = []cycloneDXHash{{Algorithm: "SHA-1", Content: checksum}}
+		}
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+var cartfileResolvedPattern = regexp.MustCompile(`^(github|git|binary) "([^"]+)" "([^"]+)"$`)
+
+// readCartfileResolved returns the dependencies of the Cartfile.resolved.
+func readCartfileResolved(pth string) ([]cycloneDXComponent, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	var components []cycloneDXComponent
+	for _, line := range strings.Split(string(content), "\n") {
+		match := cartfileResolvedPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		kind, location, version := match[1], match[2], match[3]
+
+		component := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  "carthage:" + location,
+			Name:    strings.TrimSuffix(filepath.Base(location), ".git"),
+			Version: version,
+		}
+
+		switch kind {
+		case "github":
+			component.PURL = fmt.Sprintf("pkg:github/%s@%s", location, version)
+			component.ExternalReferences = []cycloneDXExternalRef{{Type: "vcs", URL: "https://github.com/" + location}}
+		case "git":
+			component.ExternalReferences = []cycloneDXExternalRef{{Type: "vcs", URL: location}}
+		case "binary":
+			component.ExternalReferences = []cycloneDXExternalRef{{Type: "distribution", URL: location}}
+		}
+
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+// embeddedBinaryComponents returns the frameworks and dylibs of the app's Frameworks directory with their binaries' SHA-256 digests.
+func embeddedBinaryComponents(frameworksDir string) ([]cycloneDXComponent, error) {
+	entries, err := os.ReadDir(frameworksDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var components []cycloneDXComponent
+	for _, entry := range entries {
+		pth := filepath.Join(frameworksDir, entry.Name())
+
+		switch filepath.Ext(entry.Name()) {
+		case ".framework":
+			component, err := frameworkComponent(pth)
+			if err != nil {
+				return nil, err
+			}
+			components = append(components, component)
+		case ".dylib":
+			digest, err := fileSHA256(pth)
+			if err != nil {
+				return nil, err
+			}
+			components = append(components, cycloneDXComponent{
+				Type:   "library",
+				BOMRef: "embedded:" + entry.Name(),
+				Name:   strings.TrimSuffix(entry.Name(), ".dylib"),
+				Hashes: []cycloneDXHash{{Algorithm: "SHA-256", Content: digest}},
+			})
+		}
+	}
+
+	return components, nil
+}
+
+func frameworkComponent(frameworkPth string) (cycloneDXComponent, error) {
+	name := strings.TrimSuffix(filepath.Base(frameworkPth), ".framework")
+
+	// macOS frameworks are versioned bundles, Resources and the binary are symlinks into Versions/Current.
+	infoPlist := map[string]interface{}{}
+	for _, pth := range []string{
+		filepath.Join(frameworkPth, "Resources", "Info.plist"),
+		filepath.Join(frameworkPth, "Versions", "Current", "Resources", "Info.plist"),
+		filepath.Join(frameworkPth, "Info.plist"),
+	} {
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			continue
+		}
+		if _, err := plist.Unmarshal(content, &infoPlist); err != nil {
+			return cycloneDXComponent{}, fmt.Errorf("failed to parse %s: %s", pth, err)
+		}
+		break
+	}
+
+	stringValue := func(key string) string {
+		value, _ := infoPlist[key].(string)
+		return value
+	}
+
+	executable := stringValue("CFBundleExecutable")
+	if executable == "" {
+		executable = name
+	}
+	digest, err := fileSHA256(filepath.Join(frameworkPth, executable))
+	if err != nil {
+		return cycloneDXComponent{}, fmt.Errorf("failed to hash the binary of %s: %s", frameworkPth, err)
+	}
+
+	return cycloneDXComponent{
+		Type:       "framework",
+		BOMRef:     "embedded:" + filepath.Base(frameworkPth),
+		Name:       name,
+		Version:    stringValue("CFBundleShortVersionString"),
+		Hashes:     []cycloneDXHash{{Algorithm: "SHA-256", Content: digest}},
+		Properties: bundleIDProperty(stringValue("CFBundleIdentifier")),
+	}, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const podfileLock = `PODS:
+  - Alamofire (5.6.2)
+  - Firebase/Core (10.0.0):
+    - Firebase/CoreOnly
+    - FirebaseAnalytics (~> 10.0.0)
+  - Firebase/CoreOnly (10.0.0):
+    - FirebaseCore (= 10.0.0)
+
+DEPENDENCIES:
+  - Alamofire
+  - Firebase/Core
+
+SPEC CHECKSUMS:
+  Alamofire: f36a35757af4587d8e4f4bfa223ad10be2422b8c
+  Firebase: 2c9ead8d1e4ae4e4ea2cd6c4e2d0a5a0d7c5ab55
+
+PODFILE CHECKSUM: 7d5f4a08f5d9b2d39e8e8b8c8ab0c8f3d1e6d8f4
+
+COCOAPODS: 1.12.1
+`
+
+const cartfileResolved = `binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json" "10.0.0"
+git "https://gitlab.com/org/lib.git" "1.2.0"
+github "ReactiveX/RxSwift" "6.5.0"
+`
+
+func writeFile(t *testing.T, pth, content string) {
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pth, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadPodfileLock(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "Podfile.lock")
+	writeFile(t, pth, podfileLock)
+
+	got, err := readPodfileLock(pth)
+	if err != nil {
+		t.Fatalf("readPodfileLock() error = %s", err)
+	}
+
+	want := []cycloneDXComponent{
+		{
+			Type: "library", BOMRef: "cocoapods:Alamofire", Name: "Alamofire", Version: "5.6.2", PURL: "pkg:cocoapods/Alamofire@5.6.2",
+			Hashes: []cycloneDXHash{{Algorithm: "SHA-1", Content: "f36a35757af4587d8e4f4bfa223ad10be2422b8c"}},
+		},
+		{
+			Type: "library", BOMRef: "cocoapods:Firebase", Name: "Firebase", Version: "10.0.0", PURL: "pkg:cocoapods/Firebase@10.0.0",
+			Hashes: []cycloneDXHash{{Algorithm: "SHA-1", Content: "2c9ead8d1e4ae4e4ea2cd6c4e2d0a5a0d7c5ab55"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readPodfileLock() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCartfileResolved(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "Cartfile.resolved")
+	writeFile(t, pth, cartfileResolved)
+
+	got, err := readCartfileResolved(pth)
+	if err != nil {
+		t.Fatalf("readCartfileResolved() error = %s", err)
+	}
+
+	wantNames := []string{"FirebaseAnalyticsBinary.json", "lib", "RxSwift"}
+	if len(got) != len(wantNames) {
+		t.Fatalf("readCartfileResolved() returned %d components, want %d", len(got), len(wantNames))
+	}
+	for i, name := range wantNames {
+		if got[i].Name != name {
+			t.Errorf("component[%d].Name = %s, want %s", i, got[i].Name, name)
+		}
+	}
+	if got[2].PURL != "pkg:github/ReactiveX/RxSwift@6.5.0" {
+		t.Errorf("RxSwift purl = %s", got[2].PURL)
+	}
+}
+
+func TestSwiftPackageComponent(t *testing.T) {
+	got := swiftPackageComponent(packagePin{
+		Identity: "swift-log",
+		Location: "https://github.com/apple/swift-log.git",
+		Version:  "1.5.2",
+		Revision: "32e8d724467f8fe623624570367e3d50c5638e46",
+	})
+	if want := "pkg:swift/github.com/apple/swift-log@1.5.2"; got.PURL != want {
+		t.Errorf("PURL = %s, want %s", got.PURL, want)
+	}
+}
+
+func TestNewCycloneDXBOM(t *testing.T) {
+	dir := t.TempDir()
+	appPath := filepath.Join(dir, "App.app")
+	frameworkPath := filepath.Join(appPath, "Contents", "Frameworks", "Sparkle.framework")
+
+	writeFile(t, filepath.Join(frameworkPath, "Versions", "A", "Sparkle"), "binary")
+	writeFile(t, filepath.Join(frameworkPath, "Versions", "A", "Resources", "Info.plist"), `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>Sparkle</string>
+	<key>CFBundleIdentifier</key>
+	<string>org.sparkle-project.Sparkle</string>
+	<key>CFBundleShortVersionString</key>
+	<string>2.1.0</string>
+</dict>
+</plist>`)
+	for link, target := range map[string]string{
+		filepath.Join(frameworkPath, "Versions", "Current"): "A",
+		filepath.Join(frameworkPath, "Sparkle"):             "Versions/Current/Sparkle",
+		filepath.Join(frameworkPath, "Resources"):           "Versions/Current/Resources",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(appPath, "Contents", "Frameworks", "libswift_Concurrency.dylib"), "dylib")
+	writeFile(t, filepath.Join(dir, "Podfile.lock"), podfileLock)
+
+	bom, err := newCycloneDXBOM(sbomParams{
+		AppName:     "App",
+		AppVersion:  "1.0",
+		BundleID:    "io.bitrise.app",
+		AppPath:     appPath,
+		ProjectDir:  dir,
+		PackagePins: []packagePin{{Identity: "swift-log", Location: "https://github.com/apple/swift-log.git", Version: "1.5.2", Revision: "abc"}},
+		GeneratedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("newCycloneDXBOM() error = %s", err)
+	}
+
+	if !regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(bom.SerialNumber) {
+		t.Errorf("SerialNumber = %s, want a version 4 UUID URN", bom.SerialNumber)
+	}
+
+	var names []string
+	for _, component := range bom.Components {
+		names = append(names, component.Name)
+	}
+	if want := []string{"swift-log", "Alamofire", "Firebase", "Sparkle", "libswift_Concurrency"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("component names = %v, want %v", names, want)
+	}
+
+	sparkle := bom.Components[3]
+	wantSparkle := cycloneDXComponent{
+		Type:       "framework",
+		BOMRef:     "embedded:Sparkle.framework",
+		Name:       "Sparkle",
+		Version:    "2.1.0",
+		Hashes:     []cycloneDXHash{{Algorithm: "SHA-256", Content: "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd"}},
+		Properties: []cycloneDXProperty{{Name: "cdx:apple:bundleIdentifier", Value: "org.sparkle-project.Sparkle"}},
+	}
+	if !reflect.DeepEqual(sparkle, wantSparkle) {
+		t.Errorf("Sparkle component = %+v, want %+v", sparkle, wantSparkle)
+	}
+}
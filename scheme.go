@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// schemeError is a problem with the scheme, found without invoking xcodebuild.
+type schemeError struct {
+	message string
+}
+
+func (e schemeError) Error() string {
+	return e.message
+}
+
+// resolvedScheme is the scheme to archive with the projects of its archivable targets.
+type resolvedScheme struct {
+	Scheme        xcodeScheme
+	Configuration string
+	Projects      []xcodeProject
+}
+
+// Targets returns the targets the scheme builds for archiving.
+func (s resolvedScheme) Targets() []xcodeTarget {
+	var targets []xcodeTarget
+	for _, reference := range s.Scheme.ArchivableReferences() {
+		for _, project := range s.Projects {
+			if target, ok := project.Target(reference.BlueprintIdentifier); ok {
+				targets = append(targets, target)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// schemeContainers returns the project, or the workspace and every project it references.
+func schemeContainers(projectPth string) ([]string, error) {
+	containers := []string{projectPth}
+	if filepath.Ext(projectPth) != ".xcworkspace" {
+		return containers, nil
+	}
+
+	projectPths, err := workspaceProjectPaths(projectPth)
+	if err != nil {
+		return nil, err
+	}
+	return append(containers, projectPths...), nil
+}
+
+// resolveScheme finds the named scheme in the project or workspace and validates its Archive action.
+// Problems with the scheme are returned as schemeError, other errors mean the scheme could not be validated.
+func resolveScheme(projectPth, schemeName, configuration string) (resolvedScheme, error) {
+	containers, err := schemeContainers(projectPth)
+	if err != nil {
+		return resolvedScheme{}, err
+	}
+
+	var schemes []xcodeScheme
+	for _, container := range containers {
+		containerSchemes, err := xcodeSchemes(container)
+		if err != nil {
+			return resolvedScheme{}, err
+		}
+		schemes = append(schemes, containerSchemes...)
+	}
+
+	scheme, err := findScheme(schemes, schemeName, projectPth)
+	if err != nil {
+		return resolvedScheme{}, err
+	}
+
+	if !scheme.HasArchiveAction() {
+		return resolvedScheme{}, schemeError{fmt.Sprintf("scheme %s has no Archive action, edit the scheme in Xcode and set the Archive action's build configuration", scheme.Name)}
+	}
+
+	references := scheme.ArchivableReferences()
+	if len(references) == 0 {
+		return resolvedScheme{}, schemeError{fmt.Sprintf("scheme %s does not build any target for archiving, enable the Archive column for the app target in the scheme's Build action", scheme.Name)}
+	}
+
+	resolved := resolvedScheme{
+		Scheme:        scheme,
+		Configuration: configuration,
+	}
+	if resolved.Configuration == "" {
+		resolved.Configuration = scheme.ArchiveAction.BuildConfiguration
+	}
+
+	baseDir := filepath.Dir(scheme.ContainerPath)
+	opened := map[string]bool{}
+	for _, reference := range references {
+		containerPth := reference.ContainerPath(baseDir)
+		if opened[containerPth] {
+			continue
+		}
+		opened[containerPth] = true
+
+		project, err := openXcodeProject(containerPth)
+		if err != nil {
+			return resolvedScheme{}, err
+		}
+
+		if !project.HasBuildConfiguration(resolved.Configuration) {
+			available := strings.Join(project.BuildConfigurations, ", ")
+			if configuration != "" {
+				return resolvedScheme{}, schemeError{fmt.Sprintf("configuration %s does not exist in project %s, available configurations: %s", configuration, project.Name(), available)}
+			}
+			return resolvedScheme{}, schemeError{fmt.Sprintf("scheme %s archives with the %s configuration, which does not exist in project %s, available configurations: %s", scheme.Name, resolved.Configuration, project.Name(), available)}
+		}
+
+		resolved.Projects = append(resolved.Projects, project)
+	}
+
+	return resolved, nil
+}
+
+// findScheme returns the shared scheme with the given name.
+// If the project has no shared schemes, the returned error is not a schemeError: the scheme is left to xcodebuild.
+func findScheme(schemes []xcodeScheme, name, projectPth string) (xcodeScheme, error) {
+	var sharedNames []string
+	for _, scheme := range schemes {
+		if !scheme.IsShared {
+			continue
+		}
+		if scheme.Name == name {
+			return scheme, nil
+		}
+		sharedNames = append(sharedNames, scheme.Name)
+	}
+
+	for _, scheme := range schemes {
+		if scheme.Name == name {
+			return xcodeScheme{}, schemeError{fmt.Sprintf("scheme %s is not shared, it exists only in %s, mark it as Shared in Xcode's Manage Schemes window and commit the xcshareddata directory", name, scheme.Path)}
+		}
+	}
+
+	message := fmt.Sprintf("scheme %s not found in %s", name, projectPth)
+	if len(sharedNames) == 0 {
+		// xcodebuild autocreates the schemes of the targets if the project has no schemes, the scheme can not be validated.
+		return xcodeScheme{}, fmt.Errorf("%s, the project has no shared schemes, xcodebuild may autocreate it", message)
+	}
+
+	message += fmt.Sprintf(", available shared schemes: %s", strings.Join(sharedNames, ", "))
+	if suggestion := closestName(name, sharedNames); suggestion != "" {
+		message += fmt.Sprintf(", did you mean %s?", suggestion)
+	}
+	return xcodeScheme{}, schemeError{message}
+}
+
+// closestName returns the candidate most similar to the name, or an empty string if none of them is similar enough.
+func closestName(name string, candidates []string) string {
+	closest := ""
+	closestDistance := len(name)/3 + 2
+	for _, candidate := range candidates {
+		if distance := levenshteinDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < closestDistance {
+			closest = candidate
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+func levenshteinDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous = current
+	}
+
+	return previous[len(rb)]
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveScheme(t *testing.T) {
+	for _, projectPth := range []string{"testdata/App.xcodeproj", "testdata/App.xcworkspace"} {
+		resolved, err := resolveScheme(projectPth, "App", "")
+		if err != nil {
+			t.Fatalf("resolveScheme(%s) error = %s", projectPth, err)
+		}
+		if resolved.Configuration != "Release" {
+			t.Errorf("Configuration = %s, want Release", resolved.Configuration)
+		}
+
+		targets := resolved.Targets()
+		if len(targets) != 1 || targets[0].Name != "App" {
+			t.Errorf("Targets() = %v, want [App]", targets)
+		}
+	}
+}
+
+func TestResolveSchemeErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		scheme        string
+		configuration string
+		wantMessage   string
+	}{
+		{
+			name:        "typo",
+			scheme:      "Ap",
+			wantMessage: "scheme Ap not found in testdata/App.xcodeproj, available shared schemes: App, did you mean App?",
+		},
+		{
+			name:        "unrelated name",
+			scheme:      "Uploader",
+			wantMessage: "scheme Uploader not found in testdata/App.xcodeproj, available shared schemes: App",
+		},
+		{
+			name:        "user scheme",
+			scheme:      "Widget",
+			wantMessage: "scheme Widget is not shared, it exists only in testdata/App.xcodeproj/xcuserdata/bitrise.xcuserdatad/xcschemes/Widget.xcscheme",
+		},
+		{
+			name:          "missing configuration",
+			scheme:        "App",
+			configuration: "Relase",
+			wantMessage:   "configuration Relase does not exist in project App, available configurations: Debug, Release",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveScheme("testdata/App.xcodeproj", tt.scheme, tt.configuration)
+			if _, ok := err.(schemeError); !ok {
+				t.Fatalf("resolveScheme() error = %v, want schemeError", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantMessage) {
+				t.Errorf("resolveScheme() error = %s, want %s", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestResolveSchemeWithoutSharedSchemes(t *testing.T) {
+	projectPth := filepath.Join(t.TempDir(), "App.xcodeproj")
+	content, err := os.ReadFile("testdata/App.xcodeproj/project.pbxproj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(projectPth, "project.pbxproj"), string(content))
+
+	_, err = resolveScheme(projectPth, "App", "")
+	if err == nil {
+		t.Fatalf("resolveScheme() error = nil, want an error")
+	}
+	if _, ok := err.(schemeError); ok {
+		t.Errorf("resolveScheme() error = schemeError (%s), want an error leaving the scheme to xcodebuild", err)
+	}
+}
+
+func TestResolveSchemeArchiveConfiguration(t *testing.T) {
+	projectPth := filepath.Join(t.TempDir(), "App.xcodeproj")
+	schemesDir := filepath.Join(projectPth, "xcshareddata", "xcschemes")
+	if err := os.MkdirAll(schemesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pbxproj, err := os.ReadFile("testdata/App.xcodeproj/project.pbxproj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectPth, "project.pbxproj"), pbxproj, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scheme, err := os.ReadFile("testdata/App.xcodeproj/xcuserdata/bitrise.xcuserdatad/xcschemes/Widget.xcscheme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(schemesDir, "Widget.xcscheme"), scheme, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = resolveScheme(projectPth, "Widget", "")
+	want := "scheme Widget archives with the Staging configuration, which does not exist in project App, available configurations: Debug, Release"
+	if err == nil || err.Error() != want {
+		t.Errorf("resolveScheme() error = %v, want %s", err, want)
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	candidates := []string{"App", "App-Staging", "Widget"}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "app", want: "App"},
+		{name: "App-Stagin", want: "App-Staging"},
+		{name: "Widgets", want: "Widget"},
+		{name: "Uploader", want: ""},
+	}
+	for _, tt := range tests {
+		if got := closestName(tt.name, candidates); got != tt.want {
+			t.Errorf("closestName(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
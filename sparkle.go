@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-xcode/xcarchive"
+)
+
+const sparkleAppcastTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:sparkle="http://www.andymatuschak.org/xml-namespaces/sparkle" xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <channel>
+        <title>%s</title>
+    </channel>
+</rss>
+`
+
+// sparkleAppcastItem describes a single release entry of a Sparkle appcast.
+type sparkleAppcastItem struct {
+	Title                string
+	PubDate              time.Time
+	Version              string
+	ShortVersionString   string
+	MinimumSystemVersion string
+	ReleaseNotesLink     string
+
+	URL         string
+	Length      int64
+	EdSignature string
+}
+
+// String renders the item as an appcast <item> element.
+func (item sparkleAppcastItem) String() string {
+	lines := []string{
+		"        <item>",
+		fmt.Sprintf("            <title>%s</title>", xmlEscape(item.Title)),
+		fmt.Sprintf("            <pubDate>%s</pubDate>", item.PubDate.Format(time.RFC1123Z)),
+		fmt.Sprintf("            <sparkle:version>%s</sparkle:version>", xmlEscape(item.Version)),
+		fmt.Sprintf("            <sparkle:shortVersionString>%s</sparkle:shortVersionString>", xmlEscape(item.ShortVersionString)),
+	}
+	if item.MinimumSystemVersion != "" {
+		lines = append(lines, fmt.Sprintf("            <sparkle:minimumSystemVersion>%s</sparkle:minimumSystemVersion>", xmlEscape(item.MinimumSystemVersion)))
+	}
+	if item.ReleaseNotesLink != "" {
+		lines = append(lines, fmt.Sprintf("            <sparkle:releaseNotesLink>%s</sparkle:releaseNotesLink>", xmlEscape(item.ReleaseNotesLink)))
+	}
+	lines = append(lines,
+		fmt.Sprintf(`            <enclosure url="%s" length="%d" type="application/octet-stream" sparkle:edSignature="%s"/>`,
+			xmlEscape(item.URL), item.Length, xmlEscape(item.EdSignature)),
+		"        </item>",
+	)
+	return strings.Join(lines, "\n")
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return s
+	}
+	return b.String()
+}
+
+// parseSparklePrivateKey decodes a base64 encoded EdDSA private key as exported by Sparkle's generate_keys tool.
+// Both the 32 byte seed and the 64 byte expanded private key formats are accepted.
+func parseSparklePrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64 decode private key: %s", err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("invalid private key length: %d, expected %d or %d bytes", len(raw), ed25519.SeedSize, ed25519.PrivateKeySize)
+	}
+}
+
+// sparkleEdSignature returns the base64 encoded EdDSA signature of the given content,
+// in the format expected by the sparkle:edSignature attribute.
+func sparkleEdSignature(content []byte, privateKey ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content))
+}
+
+// expandArtifactURLTemplate replaces the {version}, {build} and {filename} placeholders in the given template.
+func expandArtifactURLTemplate(template, version, build, filename string) string {
+	return strings.NewReplacer(
+		"{version}", version,
+		"{build}", build,
+		"{filename}", filename,
+	).Replace(template)
+}
+
+// validateSparkleDownloadURLTemplate checks that the template expands to an absolute http(s) URL.
+func validateSparkleDownloadURLTemplate(template string) error {
+	if template == "" {
+		return fmt.Errorf("required to generate the appcast")
+	}
+
+	u, err := url.Parse(expandArtifactURLTemplate(template, "1.0", "1", "App.zip"))
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("not an absolute http(s) URL: %s", template)
+	}
+	return nil
+}
+
+// newSparkleAppcastItem creates an appcast item for the exported artifact of the archive.
+func newSparkleAppcastItem(archive xcarchive.MacosArchive, artifactPth string, privateKey ed25519.PrivateKey, downloadURLTemplate, releaseNotesURLTemplate string, pubDate time.Time) (sparkleAppcastItem, error) {
+	infoPlist := archive.Application.InfoPlist
+
+	version, _ := infoPlist.GetString("CFBundleVersion")
+	if version == "" {
+		return sparkleAppcastItem{}, fmt.Errorf("CFBundleVersion not found in the app's Info.plist")
+	}
+	shortVersion, _ := infoPlist.GetString("CFBundleShortVersionString")
+	if shortVersion == "" {
+		shortVersion = version
+	}
+	minimumSystemVersion, _ := infoPlist.GetString("LSMinimumSystemVersion")
+
+	content, err := os.ReadFile(artifactPth)
+	if err != nil {
+		return sparkleAppcastItem{}, fmt.Errorf("failed to read artifact: %s", err)
+	}
+
+	filename := filepath.Base(artifactPth)
+	return sparkleAppcastItem{
+		Title:                "Version " + shortVersion,
+		PubDate:              pubDate,
+		Version:              version,
+		ShortVersionString:   shortVersion,
+		MinimumSystemVersion: minimumSystemVersion,
+		ReleaseNotesLink:     expandArtifactURLTemplate(releaseNotesURLTemplate, shortVersion, version, filename),
+		URL:                  expandArtifactURLTemplate(downloadURLTemplate, shortVersion, version, filename),
+		Length:               int64(len(content)),
+		EdSignature:          sparkleEdSignature(content, privateKey),
+	}, nil
+}
+
+var sparkleItemPattern = regexp.MustCompile(`(?s)[ \t]*<item>.*?</item>[ \t]*\n?`)
+
+// addSparkleAppcastItem inserts the item as the newest entry of the appcast's channel.
+// An already existing item with the same sparkle:version is replaced.
+func addSparkleAppcastItem(appcast string, item sparkleAppcastItem) (string, error) {
+	if err := xml.Unmarshal([]byte(appcast), new(interface{})); err != nil {
+		return "", fmt.Errorf("invalid appcast: %s", err)
+	}
+
+	versionTag := fmt.Sprintf("<sparkle:version>%s</sparkle:version>", xmlEscape(item.Version))
+	appcast = sparkleItemPattern.ReplaceAllStringFunc(appcast, func(existing string) string {
+		if strings.Contains(existing, versionTag) {
+			return ""
+		}
+		return existing
+	})
+
+	if loc := sparkleItemPattern.FindStringIndex(appcast); loc != nil {
+		return appcast[:loc[0]] + item.String() + "\n" + appcast[loc[0]:], nil
+	}
+
+	idx := strings.LastIndex(appcast, "</channel>")
+	if idx == -1 {
+		return "", fmt.Errorf("invalid appcast: no channel element found")
+	}
+	lineStart := strings.LastIndex(appcast[:idx], "\n") + 1
+	if strings.TrimSpace(appcast[lineStart:idx]) == "" {
+		idx = lineStart
+	}
+	return appcast[:idx] + item.String() + "\n" + appcast[idx:], nil
+}
+
+// newSparkleAppcast returns an empty appcast with a channel titled after the app.
+func newSparkleAppcast(title string) string {
+	return fmt.Sprintf(sparkleAppcastTemplate, xmlEscape(title))
+}
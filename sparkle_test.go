@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSparklePrivateKey(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	want := ed25519.NewKeyFromSeed(seed)
+
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(seed),
+		base64.StdEncoding.EncodeToString(want),
+	} {
+		got, err := parseSparklePrivateKey(encoded + "\n")
+		if err != nil {
+			t.Fatalf("parseSparklePrivateKey() error = %s", err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseSparklePrivateKey() = %v, want %v", got, want)
+		}
+	}
+
+	if _, err := parseSparklePrivateKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Errorf("parseSparklePrivateKey() expected error for invalid key length")
+	}
+}
+
+func TestSparkleEdSignatureVerifies(t *testing.T) {
+	privateKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	content := []byte("artifact content")
+
+	signature, err := base64.StdEncoding.DecodeString(sparkleEdSignature(content, privateKey))
+	if err != nil {
+		t.Fatalf("failed to decode signature: %s", err)
+	}
+	if !ed25519.Verify(privateKey.Public().(ed25519.PublicKey), content, signature) {
+		t.Errorf("signature does not verify")
+	}
+}
+
+func TestExpandArtifactURLTemplate(t *testing.T) {
+	got := expandArtifactURLTemplate("https://example.com/{version}/{build}/{filename}", "1.2.0", "42", "My App.app.zip")
+	want := "https://example.com/1.2.0/42/My App.app.zip"
+	if got != want {
+		t.Errorf("expandArtifactURLTemplate() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateSparkleDownloadURLTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: "https://example.com/{version}/{filename}", wantErr: false},
+		{template: "http://example.com/app.zip", wantErr: false},
+		{template: "", wantErr: true},
+		{template: "example.com/{filename}", wantErr: true},
+		{template: "ftp://example.com/{filename}", wantErr: true},
+		{template: "https://{build}", wantErr: false},
+	}
+	for _, tt := range tests {
+		if err := validateSparkleDownloadURLTemplate(tt.template); (err != nil) != tt.wantErr {
+			t.Errorf("validateSparkleDownloadURLTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAddSparkleAppcastItem(t *testing.T) {
+	newItem := func(version string) sparkleAppcastItem {
+		return sparkleAppcastItem{
+			Title:              "Version " + version,
+			PubDate:            time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+			Version:            version,
+			ShortVersionString: "1.0." + version,
+			URL:                "https://example.com/app.zip?a=1&b=2",
+			Length:             10,
+			EdSignature:        "sig",
+		}
+	}
+
+	appcast, err := addSparkleAppcastItem(newSparkleAppcast("My App"), newItem("1"))
+	if err != nil {
+		t.Fatalf("addSparkleAppcastItem() error = %s", err)
+	}
+	if !strings.Contains(appcast, `url="https://example.com/app.zip?a=1&amp;b=2"`) {
+		t.Errorf("enclosure url is not escaped:\n%s", appcast)
+	}
+	if !strings.Contains(appcast, "<pubDate>Mon, 02 Jan 2023 03:04:05 +0000</pubDate>") {
+		t.Errorf("unexpected pubDate:\n%s", appcast)
+	}
+
+	appcast, err = addSparkleAppcastItem(appcast, newItem("2"))
+	if err != nil {
+		t.Fatalf("addSparkleAppcastItem() error = %s", err)
+	}
+	if strings.Index(appcast, "<sparkle:version>2</sparkle:version>") > strings.Index(appcast, "<sparkle:version>1</sparkle:version>") {
+		t.Errorf("new item should be the first item:\n%s", appcast)
+	}
+
+	appcast, err = addSparkleAppcastItem(appcast, newItem("1"))
+	if err != nil {
+		t.Fatalf("addSparkleAppcastItem() error = %s", err)
+	}
+	if got := strings.Count(appcast, "<item>"); got != 2 {
+		t.Errorf("expected the item with the same version to be replaced, got %d items:\n%s", got, appcast)
+	}
+
+	if _, err := addSparkleAppcastItem("<rss>", newItem("1")); err == nil {
+		t.Errorf("addSparkleAppcastItem() expected error for invalid appcast")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// packagePin is a resolved Swift package, as recorded in Package.resolved.
+type packagePin struct {
+	Identity string `json:"identity"`
+	Location string `json:"location,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Revision string `json:"revision"`
+}
+
+// packageResolved is the Package.resolved file, version 1 stores the pins under object.
+type packageResolved struct {
+	Version int                    `json:"version"`
+	Pins    []packageResolvedPin   `json:"pins"`
+	Object  *packageResolvedObject `json:"object"`
+}
+
+type packageResolvedObject struct {
+	Pins []packageResolvedPin `json:"pins"`
+}
+
+type packageResolvedPin struct {
+	Identity      string `json:"identity"`
+	Location      string `json:"location"`
+	Package       string `json:"package"`
+	RepositoryURL string `json:"repositoryURL"`
+	State         struct {
+		Version  string `json:"version"`
+		Branch   string `json:"branch"`
+		Revision string `json:"revision"`
+	} `json:"state"`
+}
+
+// spmResolveOpts configures the package resolution phase.
+type spmResolveOpts struct {
+	ProjectPath                 string
+	Scheme                      string
+	Configuration               string
+	ClonedSourcePackagesDirPath string
+	// DerivedDataPath is only passed to the package resolution, the archive command sets it on its own.
+	DerivedDataPath string
+	Strict          bool
+	Retry           retryPolicy
+	Watchdog        watchdogOpts
+}
+
+// xcodebuildOptions returns the options passed to both the package resolution and the archive command.
+func (o spmResolveOpts) xcodebuildOptions() []string {
+	var options []string
+	if o.ClonedSourcePackagesDirPath != "" {
+		options = append(options, "-clonedSourcePackagesDirPath", o.ClonedSourcePackagesDirPath)
+	}
+	if o.Strict {
+		options = append(options, "-onlyUsePackageVersionsFromResolvedFile")
+	}
+	return options
+}
+
+// resolvePackagesCommand returns the `xcodebuild -resolvePackageDependencies` command.
+// It mirrors xcodebuild.ResolvePackagesCommandModel, which only exposes Run: the watchdog needs the exec.Cmd
+// to run it in its own process group and to capture its output for the retries.
+func resolvePackagesCommand(opts spmResolveOpts) *command.Model {
+	args := []string{"-project", opts.ProjectPath}
+	if filepath.Ext(opts.ProjectPath) == ".xcworkspace" {
+		args = []string{"-workspace", opts.ProjectPath}
+	}
+	if opts.Scheme != "" {
+		args = append(args, "-scheme", opts.Scheme)
+	}
+	if opts.Configuration != "" {
+		args = append(args, "-configuration", opts.Configuration)
+	}
+	args = append(args, "-resolvePackageDependencies")
+	args = append(args, opts.xcodebuildOptions()...)
+	if opts.DerivedDataPath != "" {
+		args = append(args, "-derivedDataPath", opts.DerivedDataPath)
+	}
+	return command.New("xcodebuild", args...)
+}
+
+// packageResolvedPath returns the path of the Package.resolved file of the project or workspace.
+func packageResolvedPath(projectPth string) string {
+	if filepath.Ext(projectPth) == ".xcworkspace" {
+		return filepath.Join(projectPth, "xcshareddata", "swiftpm", "Package.resolved")
+	}
+	return filepath.Join(projectPth, "project.xcworkspace", "xcshareddata", "swiftpm", "Package.resolved")
+}
+
+// usesSwiftPackages returns true if the project or workspace has a Package.resolved file or references Swift packages.
+func usesSwiftPackages(projectPth string) (bool, error) {
+	if _, err := os.Stat(packageResolvedPath(projectPth)); err == nil {
+		return true, nil
+	}
+
+	containers, err := schemeContainers(projectPth)
+	if err != nil {
+		return false, err
+	}
+	for _, container := range containers {
+		if filepath.Ext(container) != ".xcodeproj" {
+			continue
+		}
+
+		project, err := openXcodeProject(container)
+		if err != nil {
+			return false, err
+		}
+		if len(project.PackageReferences) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readPackageResolved returns the pins of the Package.resolved file, sorted by identity.
+func readPackageResolved(pth string) ([]packagePin, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := parsePackageResolved(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", pth, err)
+	}
+	return pins, nil
+}
+
+func parsePackageResolved(content []byte) ([]packagePin, error) {
+	var resolved packageResolved
+	if err := json.Unmarshal(content, &resolved); err != nil {
+		return nil, err
+	}
+
+	rawPins := resolved.Pins
+	if resolved.Object != nil {
+		rawPins = resolved.Object.Pins
+	}
+
+	pins := []packagePin{}
+	for _, raw := range rawPins {
+		pin := packagePin{
+			Identity: raw.Identity,
+			Location: raw.Location,
+			Version:  raw.State.Version,
+			Branch:   raw.State.Branch,
+			Revision: raw.State.Revision,
+		}
+		if pin.Location == "" {
+			pin.Location = raw.RepositoryURL
+		}
+		if pin.Identity == "" {
+			pin.Identity = packageIdentity(pin.Location)
+		}
+		pins = append(pins, pin)
+	}
+
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Identity < pins[j].Identity })
+	return pins, nil
+}
+
+// packageIdentity returns the SwiftPM identity of a package location, the lowercased last path component without .git.
+func packageIdentity(location string) string {
+	name := path.Base(strings.TrimSuffix(location, "/"))
+	return strings.ToLower(strings.TrimSuffix(name, ".git"))
+}
+
+// resolvePackages runs `xcodebuild -resolvePackageDependencies`, retrying on transient failures, and returns the resolved
+// packages and the number of retries. In strict mode it fails if the Package.resolved file is missing or changes during the resolution.
+func resolvePackages(opts spmResolveOpts) ([]packagePin, int, error) {
+	resolvedPth := packageResolvedPath(opts.ProjectPath)
+
+	var pinnedPins []packagePin
+	if opts.Strict {
+		pins, err := readPackageResolved(resolvedPth)
+		if os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("Package.resolved not found at %s, resolve the packages in Xcode and commit the file", resolvedPth)
+		} else if err != nil {
+			return nil, 0, err
+		}
+		pinnedPins = pins
+	}
+
+	if opts.ClonedSourcePackagesDirPath != "" {
+		if err := os.MkdirAll(opts.ClonedSourcePackagesDirPath, 0755); err != nil {
+			return nil, 0, fmt.Errorf("failed to create the package cache directory: %s", err)
+		}
+	}
+
+	_, retries, err := opts.Retry.run("Package resolution", func() (string, error) {
+		resolveCmd := resolvePackagesCommand(opts)
+		log.TDonef("$ %s", resolveCmd.PrintableCommandArgs())
+		return runWatched("package resolution", resolveCmd.GetCmd(), os.Stdout, opts.Watchdog)
+	})
+	if err != nil {
+		return nil, retries, err
+	}
+
+	pins, err := readPackageResolved(resolvedPth)
+	if err != nil {
+		return nil, retries, fmt.Errorf("failed to read the resolved packages: %s", err)
+	}
+
+	if opts.Strict && !reflect.DeepEqual(pins, pinnedPins) {
+		return nil, retries, fmt.Errorf("package resolution changed %s, resolve the packages in Xcode and commit the file:\n%s", resolvedPth, pinsDiff(pinnedPins, pins))
+	}
+
+	return pins, retries, nil
+}
+
+// pinsDiff describes the differences between two package pin lists.
+func pinsDiff(before, after []packagePin) string {
+	beforeByIdentity := map[string]packagePin{}
+	for _, pin := range before {
+		beforeByIdentity[pin.Identity] = pin
+	}
+
+	var lines []string
+	for _, pin := range after {
+		old, ok := beforeByIdentity[pin.Identity]
+		delete(beforeByIdentity, pin.Identity)
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("+ %s %s (%s)", pin.Identity, pin.Version, pin.Revision))
+		case old != pin:
+			lines = append(lines, fmt.Sprintf("~ %s %s (%s) -> %s (%s)", pin.Identity, old.Version, old.Revision, pin.Version, pin.Revision))
+		}
+	}
+	for _, pin := range before {
+		if _, ok := beforeByIdentity[pin.Identity]; ok {
+			lines = append(lines, fmt.Sprintf("- %s %s (%s)", pin.Identity, pin.Version, pin.Revision))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
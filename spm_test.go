@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const packageResolvedV1 = `{
+  "object": {
+    "pins": [
+      {
+        "package": "Sparkle",
+        "repositoryURL": "https://github.com/sparkle-project/Sparkle.git",
+        "state": {
+          "branch": null,
+          "revision": "286edd1fa22505a9e54d170e9fd07d775ea233f2",
+          "version": "2.1.0"
+        }
+      }
+    ]
+  },
+  "version": 1
+}`
+
+const packageResolvedV2 = `{
+  "pins" : [
+    {
+      "identity" : "swift-log",
+      "kind" : "remoteSourceControl",
+      "location" : "https://github.com/apple/swift-log.git",
+      "state" : {
+        "revision" : "32e8d724467f8fe623624570367e3d50c5638e46",
+        "version" : "1.5.2"
+      }
+    },
+    {
+      "identity" : "kingfisher",
+      "kind" : "remoteSourceControl",
+      "location" : "https://github.com/onevcat/Kingfisher",
+      "state" : {
+        "branch" : "master",
+        "revision" : "3ec0ab0bca4feb56e8b33e289c9496e89059dd08"
+      }
+    }
+  ],
+  "version" : 2
+}`
+
+func TestParsePackageResolved(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []packagePin
+	}{
+		{
+			name:    "version 1",
+			content: packageResolvedV1,
+			want: []packagePin{
+				{Identity: "sparkle", Location: "https://github.com/sparkle-project/Sparkle.git", Version: "2.1.0", Revision: "286edd1fa22505a9e54d170e9fd07d775ea233f2"},
+			},
+		},
+		{
+			name:    "version 2",
+			content: packageResolvedV2,
+			want: []packagePin{
+				{Identity: "kingfisher", Location: "https://github.com/onevcat/Kingfisher", Branch: "master", Revision: "3ec0ab0bca4feb56e8b33e289c9496e89059dd08"},
+				{Identity: "swift-log", Location: "https://github.com/apple/swift-log.git", Version: "1.5.2", Revision: "32e8d724467f8fe623624570367e3d50c5638e46"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePackageResolved([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("parsePackageResolved() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePackageResolved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageResolvedPath(t *testing.T) {
+	if got, want := packageResolvedPath("/work/App.xcodeproj"), "/work/App.xcodeproj/project.xcworkspace/xcshareddata/swiftpm/Package.resolved"; got != want {
+		t.Errorf("packageResolvedPath() = %v, want %v", got, want)
+	}
+	if got, want := packageResolvedPath("/work/App.xcworkspace"), "/work/App.xcworkspace/xcshareddata/swiftpm/Package.resolved"; got != want {
+		t.Errorf("packageResolvedPath() = %v, want %v", got, want)
+	}
+}
+
+func TestSPMResolveOptsXcodebuildOptions(t *testing.T) {
+	opts := spmResolveOpts{ClonedSourcePackagesDirPath: "/cache/spm", Strict: true}
+	want := []string{"-clonedSourcePackagesDirPath", "/cache/spm", "-onlyUsePackageVersionsFromResolvedFile"}
+	if got := opts.xcodebuildOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("xcodebuildOptions() = %v, want %v", got, want)
+	}
+
+	if got := (spmResolveOpts{}).xcodebuildOptions(); len(got) != 0 {
+		t.Errorf("xcodebuildOptions() = %v, want none", got)
+	}
+}
+
+func TestResolvePackagesStrictWithoutPackageResolved(t *testing.T) {
+	opts := spmResolveOpts{ProjectPath: t.TempDir() + "/App.xcodeproj", Strict: true}
+
+	_, _, err := resolvePackages(opts)
+	if err == nil || !strings.Contains(err.Error(), "Package.resolved not found") {
+		t.Errorf("resolvePackages() error = %v, want Package.resolved not found", err)
+	}
+}
+
+func TestPinsDiff(t *testing.T) {
+	before := []packagePin{
+		{Identity: "kingfisher", Version: "7.0.0", Revision: "aaa"},
+		{Identity: "sparkle", Version: "2.1.0", Revision: "bbb"},
+	}
+	after := []packagePin{
+		{Identity: "kingfisher", Version: "7.1.0", Revision: "ccc"},
+		{Identity: "swift-log", Version: "1.5.2", Revision: "ddd"},
+	}
+
+	want := "~ kingfisher 7.0.0 (aaa) -> 7.1.0 (ccc)\n+ swift-log 1.5.2 (ddd)\n- sparkle 2.1.0 (bbb)"
+	if got := pinsDiff(before, after); got != want {
+		t.Errorf("pinsDiff() = %v, want %v", got, want)
+	}
+}
+
+func TestUsesSwiftPackages(t *testing.T) {
+	got, err := usesSwiftPackages("testdata/App.xcodeproj")
+	if err != nil {
+		t.Fatalf("usesSwiftPackages() error = %s", err)
+	}
+	if !got {
+		t.Errorf("usesSwiftPackages() = false, want true")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bitrise-io/go-steputils/output"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const stepResultFileName = "step-result.json"
+
+// failureCategory classifies the failures of the Step, every category has its own exit code,
+// so that wrapper workflows can decide whether to retry, page someone or fail fast.
+type failureCategory string
+
+const (
+	failureInput       failureCategory = "input"
+	failurePreflight   failureCategory = "project-preflight"
+	failureArchive     failureCategory = "archive"
+	failureCodeSign    failureCategory = "code-sign"
+	failureExport      failureCategory = "export"
+	failureDSYM        failureCategory = "dsym"
+	failureOutput      failureCategory = "output-export"
+	failureHang        failureCategory = "hang"
+	failureInterrupted failureCategory = "interrupted"
+	failureInternal    failureCategory = "internal"
+)
+
+var failureExitCodes = map[failureCategory]int{
+	failureInput:       10,
+	failurePreflight:   11,
+	failureArchive:     12,
+	failureCodeSign:    13,
+	failureExport:      14,
+	failureDSYM:        15,
+	failureOutput:      16,
+	failureHang:        17,
+	failureInterrupted: 130,
+}
+
+// exitCode returns the exit code of the category, 1 for internal errors.
+func (c failureCategory) exitCode() int {
+	if code, ok := failureExitCodes[c]; ok {
+		return code
+	}
+	return 1
+}
+
+// stepError is the failure of the Step.
+type stepError struct {
+	Category failureCategory
+	Message  string
+	// Command is the failing command, if the failure is the failure of a command.
+	Command string
+}
+
+func (e *stepError) Error() string {
+	return e.Message
+}
+
+func newStepError(category failureCategory, format string, v ...interface{}) *stepError {
+	return &stepError{Category: category, Message: fmt.Sprintf(format, v...)}
+}
+
+// commandError returns the failure of a command, a command stopped by the watchdog is classified as a hang.
+func commandError(category failureCategory, command string, err error, format string, v ...interface{}) *stepError {
+	if _, ok := err.(*hangError); ok {
+		category = failureHang
+	}
+	return &stepError{Category: category, Message: fmt.Sprintf(format, v...), Command: command}
+}
+
+// stepResult is the step-result.json, the machine-readable summary of the Step run.
+type stepResult struct {
+	Status   string          `json:"status"`
+	ExitCode int             `json:"exitCode"`
+	Category failureCategory `json:"category,omitempty"`
+	Message  string          `json:"message,omitempty"`
+	Command  string          `json:"command,omitempty"`
+	// Logs are the logs and reports written by the Step, by the Environment Variable exporting them.
+	Logs map[string]string `json:"logs"`
+}
+
+// newStepResult returns the result of the Step, the logs are filtered to the existing ones.
+func newStepResult(failure *stepError, logs map[string]string) (stepResult, error) {
+	result := stepResult{Status: "succeeded", Logs: map[string]string{}}
+	if failure != nil {
+		result = stepResult{
+			Status:   "failed",
+			ExitCode: failure.Category.exitCode(),
+			Category: failure.Category,
+			Message:  failure.Message,
+			Command:  failure.Command,
+			Logs:     map[string]string{},
+		}
+	}
+
+	var envKeys []string
+	for envKey := range logs {
+		envKeys = append(envKeys, envKey)
+	}
+	sort.Strings(envKeys)
+
+	for _, envKey := range envKeys {
+		if exist, err := pathutil.IsPathExists(logs[envKey]); err != nil {
+			return stepResult{}, err
+		} else if exist {
+			result.Logs[envKey] = logs[envKey]
+		}
+	}
+	return result, nil
+}
+
+func (r stepResult) json() (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// exportStepResult writes the step-result.json and exports its path.
+func exportStepResult(result stepResult, pth string) error {
+	content, err := result.json()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return err
+	}
+	return output.ExportOutputFileContent(content, pth, bitriseStepResultPthEnvKey)
+}
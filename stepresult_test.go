@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFailureCategoryExitCode(t *testing.T) {
+	codes := map[int]failureCategory{}
+	for _, category := range []failureCategory{
+		failureInput,
+		failurePreflight,
+		failureArchive,
+		failureCodeSign,
+		failureExport,
+		failureDSYM,
+		failureOutput,
+		failureHang,
+		failureInterrupted,
+	} {
+		code := category.exitCode()
+		if code <= 1 {
+			t.Errorf("%s exit code = %d, want a distinct code above 1", category, code)
+		}
+		if other, ok := codes[code]; ok {
+			t.Errorf("%s and %s share the exit code %d", category, other, code)
+		}
+		codes[code] = category
+	}
+
+	if got := failureInternal.exitCode(); got != 1 {
+		t.Errorf("internal exit code = %d, want 1", got)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want failureCategory
+	}{
+		{
+			name: "command failure",
+			err:  fmt.Errorf("exit status 65"),
+			want: failureArchive,
+		},
+		{
+			name: "watchdog hang",
+			err:  &hangError{Phase: "archive", Reason: "no output for 20m0s"},
+			want: failureHang,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := commandError(failureArchive, "xcodebuild archive", tt.err, "Archive failed, error: %s", tt.err)
+			if got.Category != tt.want {
+				t.Errorf("Category = %s, want %s", got.Category, tt.want)
+			}
+			if got.Command != "xcodebuild archive" {
+				t.Errorf("Command = %q, want the failing command", got.Command)
+			}
+		})
+	}
+}
+
+func TestNewStepResult(t *testing.T) {
+	dir := t.TempDir()
+	rawLogPath := filepath.Join(dir, "raw-xcodebuild-output.log")
+	if err := os.WriteFile(rawLogPath, []byte("** ARCHIVE FAILED **"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logs := map[string]string{
+		bitriseXcodeRawResultTextEnvKey:     rawLogPath,
+		bitriseIDEDistributionLogsPthEnvKey: filepath.Join(dir, "xcodebuild.xcdistributionlogs.zip"),
+	}
+
+	failure := &stepError{Category: failureArchive, Message: "Archive failed, error: exit status 65", Command: "xcodebuild archive"}
+	result, err := newStepResult(failure, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := result.json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got stepResult
+	if err := json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := stepResult{
+		Status:   "failed",
+		ExitCode: 12,
+		Category: failureArchive,
+		Message:  "Archive failed, error: exit status 65",
+		Command:  "xcodebuild archive",
+		Logs:     map[string]string{bitriseXcodeRawResultTextEnvKey: rawLogPath},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("step result = %+v, want %+v", got, want)
+	}
+
+	success, err := newStepResult(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success.Status != "succeeded" || success.ExitCode != 0 || success.Category != "" {
+		t.Errorf("step result = %+v, want a success", success)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-xcode/profileutil"
+	"github.com/bitrise-io/go-xcode/xcarchive"
+)
+
+const (
+	buildSummaryFileName  = "build-summary.md"
+	buildSummaryMaxErrors = 5
+)
+
+// buildSummary is the Markdown summary of the Step run, posted by PR bots and CI annotation steps.
+// It is filled in as the Step progresses and rendered on exit, so a failed run is summarized too.
+type buildSummary struct {
+	AppName string
+	// IconPath is the extracted app icon, shown next to the title.
+	IconPath     string
+	Version      string
+	BuildNumber  string
+	BundleID     string
+	ExportMethod string
+
+	SigningIdentity string
+	Profiles        []summaryProfile
+
+	// OutputDir is the directory the artifact paths are shown relative to.
+	OutputDir string
+	Artifacts []artifact
+	XCResult  *xcresultSummary
+	Failure   *stepError
+}
+
+// summaryProfile is a provisioning profile used to sign a bundle of the app.
+type summaryProfile struct {
+	Name           string
+	BundleID       string
+	ExpirationDate time.Time
+}
+
+// setApplication sets the name, versions and bundle ID of the archived app.
+func (s *buildSummary) setApplication(archive xcarchive.MacosArchive) {
+	infoPlist := archive.Application.InfoPlist
+	s.AppName = appNameFromArchive(archive)
+	s.Version, _ = infoPlist.GetString("CFBundleShortVersionString")
+	s.BuildNumber, _ = infoPlist.GetString("CFBundleVersion")
+	s.BundleID, _ = infoPlist.GetString("CFBundleIdentifier")
+}
+
+// setProfiles sets the provisioning profiles by bundle ID, sorted by bundle ID.
+func (s *buildSummary) setProfiles(bundleIDProfiles map[string]profileutil.ProvisioningProfileInfoModel) {
+	s.Profiles = nil
+	for bundleID, profile := range bundleIDProfiles {
+		s.Profiles = append(s.Profiles, summaryProfile{Name: profile.Name, BundleID: bundleID, ExpirationDate: profile.ExpirationDate})
+	}
+	sort.Slice(s.Profiles, func(i, j int) bool { return s.Profiles[i].BundleID < s.Profiles[j].BundleID })
+}
+
+// topErrors returns the first errors of the result bundle, or the failure message of the Step if the result bundle has none.
+func (s buildSummary) topErrors() []string {
+	var errors []string
+	if s.XCResult != nil {
+		for _, issue := range s.XCResult.IssuesWithSeverity(xcresultSeverityError) {
+			errors = append(errors, issue.String())
+		}
+	}
+	if len(errors) == 0 && s.Failure != nil {
+		errors = append(errors, s.Failure.Message)
+	}
+	if len(errors) > buildSummaryMaxErrors {
+		errors = errors[:buildSummaryMaxErrors]
+	}
+	return errors
+}
+
+// markdown renders the summary.
+func (s buildSummary) markdown() string {
+	var b strings.Builder
+
+	title := s.AppName
+	if title == "" {
+		title = "Archive"
+	}
+	if s.Version != "" {
+		title += " " + s.Version
+	}
+	if s.BuildNumber != "" {
+		title += fmt.Sprintf(" (%s)", s.BuildNumber)
+	}
+	if s.IconPath != "" {
+		fmt.Fprintf(&b, "<img src=\"%s\" alt=\"App icon\" width=\"64\" height=\"64\">\n\n", s.relativePath(s.IconPath))
+	}
+	fmt.Fprintf(&b, "## %s\n\n", markdownEscape(title))
+
+	status := "Succeeded"
+	if s.Failure != nil {
+		status = fmt.Sprintf("Failed (%s, exit code %d)", s.Failure.Category, s.Failure.Category.exitCode())
+	}
+
+	rows := [][2]string{{"Status", status}}
+	if s.BundleID != "" {
+		rows = append(rows, [2]string{"Bundle ID", "`" + s.BundleID + "`"})
+	}
+	if s.ExportMethod != "" {
+		rows = append(rows, [2]string{"Export method", s.ExportMethod})
+	}
+	if s.SigningIdentity != "" {
+		rows = append(rows, [2]string{"Signing identity", s.SigningIdentity})
+	}
+	for _, profile := range s.Profiles {
+		value := fmt.Sprintf("%s (`%s`)", profile.Name, profile.BundleID)
+		if !profile.ExpirationDate.IsZero() {
+			value += ", expires " + profile.ExpirationDate.Format("2006-01-02")
+		}
+		rows = append(rows, [2]string{"Provisioning profile", value})
+	}
+	if s.XCResult != nil {
+		rows = append(rows, [2]string{"Warnings", fmt.Sprintf("%d", len(s.XCResult.IssuesWithSeverity(xcresultSeverityWarning)))})
+	}
+
+	b.WriteString("| | |\n|---|---|\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], markdownEscape(row[1]))
+	}
+
+	if len(s.Artifacts) > 0 {
+		b.WriteString("\n### Artifacts\n\n| Artifact | Size |\n|---|---:|\n")
+		for _, a := range s.Artifacts {
+			fmt.Fprintf(&b, "| `%s` | %s |\n", s.relativePath(a.Path), formatSize(a.Size))
+		}
+	}
+
+	if errors := s.topErrors(); len(errors) > 0 {
+		b.WriteString("\n### Errors\n\n")
+		for _, message := range errors {
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimSpace(message))
+		}
+	}
+
+	return b.String()
+}
+
+// relativePath returns the path relative to the output directory, the summary is stored next to the artifacts.
+func (s buildSummary) relativePath(pth string) string {
+	if rel, err := filepath.Rel(s.OutputDir, pth); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return pth
+}
+
+// markdownEscape escapes the characters breaking a table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// formatSize returns the size in bytes with a decimal unit, e.g. 12.3 MB.
+func formatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGT"[exp])
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-xcode/plistutil"
+	"github.com/bitrise-io/go-xcode/profileutil"
+	"github.com/bitrise-io/go-xcode/xcarchive"
+)
+
+func TestBuildSummaryMarkdown(t *testing.T) {
+	summary := buildSummary{ExportMethod: "developer-id", OutputDir: "/deploy"}
+	var archive xcarchive.MacosArchive
+	archive.Application.Path = "/archives/Sample.xcarchive/Products/Applications/Sample.app"
+	archive.Application.InfoPlist = plistutil.PlistData{
+		"CFBundleName":               "Sample",
+		"CFBundleDisplayName":        "Sample App",
+		"CFBundleShortVersionString": "1.2.0",
+		"CFBundleVersion":            "42",
+		"CFBundleIdentifier":         "io.bitrise.sample",
+	}
+	summary.setApplication(archive)
+	summary.SigningIdentity = "Developer ID Application: Bitrise (72SA8V3WYL)"
+	summary.setProfiles(map[string]profileutil.ProvisioningProfileInfoModel{
+		"io.bitrise.sample.widget": {Name: "Widget Developer ID", ExpirationDate: time.Date(2027, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		"io.bitrise.sample":        {Name: "Sample Developer ID", ExpirationDate: time.Date(2027, time.January, 15, 0, 0, 0, 0, time.UTC)},
+	})
+	summary.Artifacts = []artifact{
+		{Path: "/deploy/Sample.app.zip", Size: 12345678},
+		{Path: "/deploy/Sample.dSYM.zip", Size: 512},
+	}
+	summary.XCResult = &xcresultSummary{Issues: []xcresultIssue{
+		{Severity: xcresultSeverityWarning, Message: "unused variable 'x'"},
+		{Severity: xcresultSeverityWarning, Message: "'NSApp' is deprecated"},
+	}}
+
+	want := "## Sample App 1.2.0 (42)\n\n" +
+		"| | |\n|---|---|\n" +
+		"| Status | Succeeded |\n" +
+		"| Bundle ID | `io.bitrise.sample` |\n" +
+		"| Export method | developer-id |\n" +
+		"| Signing identity | Developer ID Application: Bitrise (72SA8V3WYL) |\n" +
+		"| Provisioning profile | Sample Developer ID (`io.bitrise.sample`), expires 2027-01-15 |\n" +
+		"| Provisioning profile | Widget Developer ID (`io.bitrise.sample.widget`), expires 2027-03-01 |\n" +
+		"| Warnings | 2 |\n" +
+		"\n### Artifacts\n\n| Artifact | Size |\n|---|---:|\n" +
+		"| `Sample.app.zip` | 12.3 MB |\n" +
+		"| `Sample.dSYM.zip` | 512 B |\n"
+
+	if got := summary.markdown(); got != want {
+		t.Errorf("markdown() = \n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBuildSummarySetApplicationBundleName(t *testing.T) {
+	var archive xcarchive.MacosArchive
+	archive.Application.Path = "/archives/Sample.xcarchive/Products/Applications/Sample.app"
+	archive.Application.InfoPlist = plistutil.PlistData{"CFBundleShortVersionString": "1.2.0"}
+
+	var summary buildSummary
+	summary.setApplication(archive)
+	if summary.AppName != "Sample" || summary.Version != "1.2.0" {
+		t.Errorf("setApplication() = %q %q, want the .app bundle's name and the version", summary.AppName, summary.Version)
+	}
+}
+
+func TestBuildSummaryTopErrors(t *testing.T) {
+	failure := newStepError(failureArchive, "Archive failed, error: exit status 65")
+
+	t.Run("failure without result bundle", func(t *testing.T) {
+		summary := buildSummary{Failure: failure}
+		got := summary.markdown()
+		for _, want := range []string{
+			"## Archive\n",
+			"| Status | Failed (archive, exit code 12) |",
+			"### Errors\n\n```\nArchive failed, error: exit status 65\n```\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("markdown() = \n%s\nshould contain %q", got, want)
+			}
+		}
+	})
+
+	t.Run("result bundle errors", func(t *testing.T) {
+		var issues []xcresultIssue
+		for i := 0; i < buildSummaryMaxErrors+2; i++ {
+			issues = append(issues, xcresultIssue{Severity: xcresultSeverityError, Message: "cannot find 'NSApp' in scope", Location: "/work/App/AppDelegate.swift:12"})
+		}
+		summary := buildSummary{Failure: failure, XCResult: &xcresultSummary{Issues: issues}}
+
+		got := summary.topErrors()
+		if len(got) != buildSummaryMaxErrors {
+			t.Fatalf("topErrors() = %d error(s), want %d", len(got), buildSummaryMaxErrors)
+		}
+		if want := "/work/App/AppDelegate.swift:12: error: cannot find 'NSApp' in scope"; got[0] != want {
+			t.Errorf("topErrors()[0] = %q, want %q", got[0], want)
+		}
+	})
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, want := range map[int64]string{
+		0:          "0 B",
+		999:        "999 B",
+		1000:       "1.0 kB",
+		12345678:   "12.3 MB",
+		3200000000: "3.2 GB",
+	} {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
+
+func TestBuildSummaryIcon(t *testing.T) {
+	summary := buildSummary{AppName: "Sample", OutputDir: "/deploy", IconPath: "/deploy/Sample-icon.png"}
+
+	want := "<img src=\"Sample-icon.png\" alt=\"App icon\" width=\"64\" height=\"64\">\n\n## Sample\n\n"
+	if got := summary.markdown(); !strings.HasPrefix(got, want) {
+		t.Errorf("markdown() = \n%s\nshould start with %q", got, want)
+	}
+}
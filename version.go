@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-xcode/plistutil"
+)
+
+// versionPattern matches the CFBundleVersion and CFBundleShortVersionString format: one to three period-separated integers.
+var versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+
+// versionOverride is a build setting overriding one of the version keys of the app's Info.plist.
+type versionOverride struct {
+	Input        string
+	BuildSetting string
+	InfoPlistKey string
+	Value        string
+}
+
+// versionOverrides are the build number and marketing version the app is archived with.
+type versionOverrides []versionOverride
+
+// newVersionOverrides validates the build_number, build_number_offset and marketing_version inputs.
+// The offset is added to the build number, e.g. to continue the numbering of a previous CI service,
+// if the build_number input is empty it is added to the CI build number ($BITRISE_BUILD_NUMBER).
+func newVersionOverrides(buildNumber string, buildNumberOffset int, marketingVersion, ciBuildNumber string) (versionOverrides, error) {
+	if buildNumberOffset != 0 {
+		if buildNumber == "" {
+			buildNumber = ciBuildNumber
+		}
+		if buildNumber == "" {
+			return nil, fmt.Errorf("build_number_offset is set, but both build_number and BITRISE_BUILD_NUMBER are empty")
+		}
+
+		number, err := strconv.Atoi(buildNumber)
+		if err != nil {
+			return nil, fmt.Errorf("build_number_offset requires an integer build_number, got: %s", buildNumber)
+		}
+		if number+buildNumberOffset < 0 {
+			return nil, fmt.Errorf("build number (%d) plus build_number_offset (%d) is negative", number, buildNumberOffset)
+		}
+		buildNumber = strconv.Itoa(number + buildNumberOffset)
+	}
+
+	var overrides versionOverrides
+	for _, override := range []versionOverride{
+		{Input: "build_number", BuildSetting: "CURRENT_PROJECT_VERSION", InfoPlistKey: "CFBundleVersion", Value: buildNumber},
+		{Input: "marketing_version", BuildSetting: "MARKETING_VERSION", InfoPlistKey: "CFBundleShortVersionString", Value: marketingVersion},
+	} {
+		if override.Value == "" {
+			continue
+		}
+		if !versionPattern.MatchString(override.Value) {
+			return nil, fmt.Errorf("invalid %s (%s): use one to three period-separated integers, e.g. 1.2.3", override.Input, override.Value)
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+// buildSettings returns the build settings passed to the archive command.
+func (o versionOverrides) buildSettings() []buildSetting {
+	var settings []buildSetting
+	for _, override := range o {
+		settings = append(settings, buildSetting{Key: override.BuildSetting, Value: override.Value, Source: override.Input})
+	}
+	return settings
+}
+
+// infoPlistMismatches returns the overridden versions the archived app's Info.plist does not contain.
+func (o versionOverrides) infoPlistMismatches(infoPlist plistutil.PlistData) []string {
+	var mismatches []string
+	for _, override := range o {
+		if value, _ := infoPlist.GetString(override.InfoPlistKey); value != override.Value {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, expected %q (%s input)", override.InfoPlistKey, value, override.Value, override.Input))
+		}
+	}
+	return mismatches
+}
+
+// hardcodedVersions returns the overridden version keys the Info.plist files of the scheme's application
+// targets set to a literal value instead of the build setting, the override has no effect on these.
+func (o versionOverrides) hardcodedVersions(scheme resolvedScheme) ([]string, error) {
+	var hardcoded []string
+	for _, reference := range scheme.Scheme.ArchivableReferences() {
+		for _, project := range scheme.Projects {
+			target, ok := project.Target(reference.BlueprintIdentifier)
+			if !ok || !target.IsApplication() {
+				continue
+			}
+
+			pth := project.InfoPlistPath(target, scheme.Configuration)
+			if pth == "" {
+				continue
+			}
+
+			infoPlist, err := plistutil.NewPlistDataFromFile(pth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the Info.plist of %s: %s", target.Name, err)
+			}
+
+			for _, override := range o {
+				value, ok := infoPlist.GetString(override.InfoPlistKey)
+				if ok && !strings.Contains(value, "$(") && !strings.Contains(value, "${") {
+					hardcoded = append(hardcoded, fmt.Sprintf("%s: %s is hardcoded to %q in %s, use $(%s) instead", target.Name, override.InfoPlistKey, value, pth, override.BuildSetting))
+				}
+			}
+		}
+	}
+	return hardcoded, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-xcode/plistutil"
+)
+
+func TestNewVersionOverrides(t *testing.T) {
+	tests := []struct {
+		name              string
+		buildNumber       string
+		buildNumberOffset int
+		marketingVersion  string
+		ciBuildNumber     string
+		want              []buildSetting
+		wantErr           string
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:             "build number and marketing version",
+			buildNumber:      "1205",
+			marketingVersion: "2.1",
+			want: []buildSetting{
+				{Key: "CURRENT_PROJECT_VERSION", Value: "1205", Source: "build_number"},
+				{Key: "MARKETING_VERSION", Value: "2.1", Source: "marketing_version"},
+			},
+		},
+		{
+			name:              "build number offset",
+			buildNumber:       "205",
+			buildNumberOffset: 1000,
+			want:              []buildSetting{{Key: "CURRENT_PROJECT_VERSION", Value: "1205", Source: "build_number"}},
+		},
+		{
+			name:              "offset without build number",
+			buildNumberOffset: 1000,
+			ciBuildNumber:     "205",
+			want:              []buildSetting{{Key: "CURRENT_PROJECT_VERSION", Value: "1205", Source: "build_number"}},
+		},
+		{
+			name:              "offset without build number and CI build number",
+			buildNumberOffset: 1000,
+			wantErr:           "both build_number and BITRISE_BUILD_NUMBER are empty",
+		},
+		{
+			name:              "offset with a dotted build number",
+			buildNumber:       "1.2",
+			buildNumberOffset: 1000,
+			wantErr:           "requires an integer build_number",
+		},
+		{
+			name:             "invalid marketing version",
+			marketingVersion: "2.1-beta",
+			wantErr:          "invalid marketing_version (2.1-beta)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newVersionOverrides(tt.buildNumber, tt.buildNumberOffset, tt.marketingVersion, tt.ciBuildNumber)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newVersionOverrides() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newVersionOverrides() error = %s", err)
+			}
+			if settings := got.buildSettings(); !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("buildSettings() = %v, want %v", settings, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionOverridesInfoPlistMismatches(t *testing.T) {
+	versions, err := newVersionOverrides("1205", 0, "2.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infoPlist := plistutil.PlistData{"CFBundleVersion": "42", "CFBundleShortVersionString": "2.1"}
+	want := []string{`CFBundleVersion is "42", expected "1205" (build_number input)`}
+	if got := versions.infoPlistMismatches(infoPlist); !reflect.DeepEqual(got, want) {
+		t.Errorf("infoPlistMismatches() = %v, want %v", got, want)
+	}
+}
+
+func TestVersionOverridesHardcodedVersions(t *testing.T) {
+	resolved, err := resolveScheme("testdata/App.xcodeproj", "App", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := newVersionOverrides("1205", 0, "2.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := versions.hardcodedVersions(resolved)
+	if err != nil {
+		t.Fatalf("hardcodedVersions() error = %s", err)
+	}
+
+	infoPlistPth, err := filepath.Abs(filepath.Join("testdata", "App", "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`App: CFBundleVersion is hardcoded to "42" in ` + infoPlistPth + `, use $(CURRENT_PROJECT_VERSION) instead`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hardcodedVersions() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/stringutil"
+	"github.com/bitrise-io/go-xcode/xcodebuild"
+	"github.com/bitrise-io/go-xcode/xcpretty"
+)
+
+const (
+	watchdogGracePeriod   = 30 * time.Second
+	watchdogCheckInterval = time.Second
+	hangLogTailLines      = 20
+)
+
+// watchdogOpts are the limits of a phase (package resolution, archive, export), a zero limit is disabled.
+type watchdogOpts struct {
+	// Timeout is the overall duration of the phase, OutputTimeout is the longest time without output.
+	Timeout       time.Duration
+	OutputTimeout time.Duration
+	// GracePeriod is the time between terminating the process group and killing it.
+	GracePeriod time.Duration
+}
+
+// expired returns why the phase is considered hanging, or an empty string.
+func (o watchdogOpts) expired(now, started, lastOutput time.Time) string {
+	if o.Timeout > 0 && now.Sub(started) >= o.Timeout {
+		return fmt.Sprintf("did not finish in %s", o.Timeout)
+	}
+	if o.OutputTimeout > 0 && now.Sub(lastOutput) >= o.OutputTimeout {
+		return fmt.Sprintf("no output for %s", o.OutputTimeout)
+	}
+	return ""
+}
+
+// checkInterval returns how often the limits are checked, at least ten times within the shortest limit.
+func (o watchdogOpts) checkInterval() time.Duration {
+	interval := watchdogCheckInterval
+	for _, limit := range []time.Duration{o.Timeout, o.OutputTimeout} {
+		if limit > 0 && limit/10 < interval {
+			interval = limit / 10
+		}
+	}
+	return interval
+}
+
+// hangError is returned if the watchdog terminated a hanging phase.
+type hangError struct {
+	Phase   string
+	Reason  string
+	Elapsed time.Duration
+	// Processes is the process list of the process group at the time of the hang, LogTail is the end of the raw output.
+	Processes string
+	LogTail   string
+}
+
+func (e *hangError) Error() string {
+	return fmt.Sprintf("hang: %s %s, terminated after %s", e.Phase, e.Reason, e.Elapsed.Round(time.Second))
+}
+
+// outputActivity records the time of the last output.
+type outputActivity struct {
+	last atomic.Int64
+}
+
+func (a *outputActivity) Write(p []byte) (int, error) {
+	a.touch(time.Now())
+	return len(p), nil
+}
+
+func (a *outputActivity) touch(t time.Time) { a.last.Store(t.UnixNano()) }
+
+func (a *outputActivity) lastOutput() time.Time { return time.Unix(0, a.last.Load()) }
+
+// runWatched runs the command in its own process group, writes its combined output to out and returns the output.
+// If the phase exceeds a limit of the watchdog, the process list and the tail of the output are printed,
+// the process group is terminated gracefully then forcefully, and a *hangError is returned.
+func runWatched(phase string, cmd *exec.Cmd, out io.Writer, opts watchdogOpts) (string, error) {
+	return runWatchedPipeline(phase, cmd, nil, out, opts)
+}
+
+// runWatchedPipeline is runWatched with the output of the command piped to the formatter (e.g. xcpretty), which writes to out.
+// The formatter runs in the process group of the command: a hanging formatter blocks the output of the command,
+// and the watchdog lists and terminates both of them. It returns the raw output of the command.
+func runWatchedPipeline(phase string, cmd, formatter *exec.Cmd, out io.Writer, opts watchdogOpts) (string, error) {
+	var buf bytes.Buffer
+	activity := &outputActivity{}
+
+	pgid := 0
+	var pipeWriter *io.PipeWriter
+	if formatter != nil {
+		var pipeReader *io.PipeReader
+		pipeReader, pipeWriter = io.Pipe()
+		formatter.Stdin = pipeReader
+		formatter.Stdout = out
+		formatter.Stderr = out
+		formatter.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		formatter.WaitDelay = opts.GracePeriod
+		if err := formatter.Start(); err != nil {
+			return "", err
+		}
+		pgid = formatter.Process.Pid
+		out = pipeWriter
+	}
+
+	// The activity is recorded after the output is written, a blocked formatter stops the output.
+	writer := io.MultiWriter(&buf, out, activity)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	// A zero Pgid starts a new process group, the command joins the group of the formatter otherwise.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+	if opts.GracePeriod > 0 {
+		// Children escaping the process group may keep the output open, stop waiting for them after the grace period.
+		cmd.WaitDelay = opts.GracePeriod
+	}
+
+	wait := func() error {
+		err := cmd.Wait()
+		if formatter != nil {
+			// The formatter exits once it read the rest of the output.
+			if closeErr := pipeWriter.Close(); closeErr != nil {
+				log.Warnf("Failed to close the output pipe of %s, error: %s", formatter.Args[0], closeErr)
+			}
+			if waitErr := formatter.Wait(); waitErr != nil {
+				log.Warnf("%s command failed, error: %s", formatter.Args[0], waitErr)
+			}
+		}
+		return err
+	}
+
+	started := time.Now()
+	activity.touch(started)
+	if err := cmd.Start(); err != nil {
+		if formatter != nil {
+			if closeErr := pipeWriter.Close(); closeErr != nil {
+				log.Warnf("Failed to close the output pipe of %s, error: %s", formatter.Args[0], closeErr)
+			}
+			_ = formatter.Wait()
+		}
+		return "", err
+	}
+	if pgid == 0 {
+		pgid = cmd.Process.Pid
+	}
+
+	stepLifecycle.addProcessGroup(pgid)
+	defer stepLifecycle.removeProcessGroup(pgid)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- wait()
+	}()
+
+	ticker := time.NewTicker(opts.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return buf.String(), err
+		case now := <-ticker.C:
+			reason := opts.expired(now, started, activity.lastOutput())
+			if reason == "" {
+				continue
+			}
+
+			hang := &hangError{
+				Phase:     phase,
+				Reason:    reason,
+				Elapsed:   now.Sub(started),
+				Processes: processSnapshot(pgid),
+			}
+
+			fmt.Println()
+			log.Errorf("%s %s, terminating it", phase, reason)
+			log.Printf("Processes:\n%s", hang.Processes)
+
+			terminateProcessGroup(pgid, done, opts.GracePeriod)
+
+			hang.LogTail = stringutil.LastNLines(buf.String(), hangLogTailLines)
+			log.Printf("Last lines of the output:\n%s", hang.LogTail)
+
+			return buf.String(), hang
+		}
+	}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group, then SIGKILL if it is still running after the grace period,
+// and waits for the process to exit.
+func terminateProcessGroup(pgid int, done <-chan error, gracePeriod time.Duration) {
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		log.Warnf("Failed to terminate process group %d, error: %s", pgid, err)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	log.Warnf("Process group %d is still running after %s, killing it", pgid, gracePeriod)
+	if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil {
+		log.Warnf("Failed to kill process group %d, error: %s", pgid, err)
+	}
+	<-done
+}
+
+// processSnapshot returns the `ps` output of the processes of the process group.
+func processSnapshot(pgid int) string {
+	out, err := exec.Command("ps", "-A", "-o", "pid,ppid,pgid,stat,etime,command").Output()
+	if err != nil {
+		return fmt.Sprintf("failed to list the processes: %s", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if i == 0 || (len(fields) > 2 && fields[2] == strconv.Itoa(pgid)) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runXcodebuild runs the xcodebuild command under the watchdog, piping its output to xcpretty if it is the output tool,
+// and returns the raw xcodebuild output.
+func runXcodebuild(phase string, xcodebuildCmd xcodebuild.CommandModel, outputTool string, opts watchdogOpts) (string, error) {
+	cmd := xcodebuildCmd.Command().GetCmd()
+	if outputTool != "xcpretty" {
+		return runWatched(phase, cmd, os.Stdout, opts)
+	}
+
+	prettyCmd := xcpretty.New(xcodebuildCmd).Command().GetCmd()
+	return runWatchedPipeline(phase, cmd, prettyCmd, os.Stdout, opts)
+}
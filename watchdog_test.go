@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWatched(t *testing.T) {
+	out, err := runWatched("archive", exec.Command("sh", "-c", "echo first; sleep 0.1; echo second"), io.Discard, watchdogOpts{
+		Timeout:       10 * time.Second,
+		OutputTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("runWatched() error = %s", err)
+	}
+	if out != "first\nsecond\n" {
+		t.Errorf("runWatched() = %q, want the output of the command", out)
+	}
+
+	if _, err := runWatched("archive", exec.Command("sh", "-c", "exit 65"), io.Discard, watchdogOpts{}); err == nil || !strings.Contains(err.Error(), "exit status 65") {
+		t.Errorf("runWatched() error = %v, want exit status 65", err)
+	}
+}
+
+func TestRunWatchedNoOutputTimeout(t *testing.T) {
+	// The background sleep of the same process group has to be terminated too.
+	cmd := exec.Command("sh", "-c", "echo Resolving packages; sleep 30 & sleep 30")
+	started := time.Now()
+
+	out, err := runWatched("package resolution", cmd, io.Discard, watchdogOpts{
+		OutputTimeout: 300 * time.Millisecond,
+		GracePeriod:   time.Second,
+	})
+
+	hang, ok := err.(*hangError)
+	if !ok {
+		t.Fatalf("runWatched() error = %v, want a hang error", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("runWatched() returned after %s, want the process group terminated", elapsed)
+	}
+	if hang.Phase != "package resolution" || hang.Reason != "no output for 300ms" {
+		t.Errorf("hangError = %+v, want a package resolution hang without output", hang)
+	}
+	if !strings.Contains(hang.LogTail, "Resolving packages") || out != "Resolving packages\n" {
+		t.Errorf("LogTail = %q, output = %q, want the output of the command", hang.LogTail, out)
+	}
+	if !strings.Contains(hang.Processes, "PGID") {
+		t.Errorf("Processes = %q, want the process list", hang.Processes)
+	}
+	if !strings.HasPrefix(hang.Error(), "hang: package resolution no output for 300ms") {
+		t.Errorf("Error() = %s", hang.Error())
+	}
+}
+
+func TestRunWatchedKillsAfterGracePeriod(t *testing.T) {
+	// The command keeps printing and ignores SIGTERM, only the overall timeout and SIGKILL stop it.
+	cmd := exec.Command("sh", "-c", "trap '' TERM; while true; do echo exporting; sleep 0.05; done")
+	started := time.Now()
+
+	_, err := runWatched("export", cmd, io.Discard, watchdogOpts{
+		Timeout:       300 * time.Millisecond,
+		OutputTimeout: time.Minute,
+		GracePeriod:   200 * time.Millisecond,
+	})
+
+	hang, ok := err.(*hangError)
+	if !ok {
+		t.Fatalf("runWatched() error = %v, want a hang error", err)
+	}
+	if hang.Reason != "did not finish in 300ms" {
+		t.Errorf("Reason = %s, want the overall timeout", hang.Reason)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("runWatched() returned after %s, want the process group killed", elapsed)
+	}
+}
+
+func TestRunWatchedPipeline(t *testing.T) {
+	var formatted strings.Builder
+	out, err := runWatchedPipeline("archive", exec.Command("sh", "-c", "echo first; echo second"), exec.Command("tr", "a-z", "A-Z"), &formatted, watchdogOpts{
+		OutputTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("runWatchedPipeline() error = %s", err)
+	}
+	if out != "first\nsecond\n" {
+		t.Errorf("runWatchedPipeline() = %q, want the raw output of the command", out)
+	}
+	if formatted.String() != "FIRST\nSECOND\n" {
+		t.Errorf("formatted output = %q, want the output of the formatter", formatted.String())
+	}
+}
+
+func TestRunWatchedPipelineHangingFormatter(t *testing.T) {
+	// The formatter never reads its input, the command blocks on its output.
+	formatter := exec.Command("sleep", "30")
+	started := time.Now()
+
+	_, err := runWatchedPipeline("archive", exec.Command("sh", "-c", "echo Compiling; echo Linking"), formatter, io.Discard, watchdogOpts{
+		OutputTimeout: 300 * time.Millisecond,
+		GracePeriod:   time.Second,
+	})
+
+	if _, ok := err.(*hangError); !ok {
+		t.Fatalf("runWatchedPipeline() error = %v, want a hang error", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("runWatchedPipeline() returned after %s, want the formatter terminated", elapsed)
+	}
+	if formatter.ProcessState == nil {
+		t.Errorf("formatter is still running, want it terminated with the process group")
+	}
+}
+
+func TestWatchdogOptsCheckInterval(t *testing.T) {
+	if got := (watchdogOpts{}).checkInterval(); got != watchdogCheckInterval {
+		t.Errorf("checkInterval() = %s, want %s", got, watchdogCheckInterval)
+	}
+	if got := (watchdogOpts{Timeout: time.Hour, OutputTimeout: 2 * time.Second}).checkInterval(); got != 200*time.Millisecond {
+		t.Errorf("checkInterval() = %s, want 200ms", got)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of the given path.
+// If noFollow is set and the path is a symlink, the attributes of the link itself are returned.
+func readXattrs(pth string, noFollow bool) (map[string][]byte, error) {
+	list, get := unix.Listxattr, unix.Getxattr
+	if noFollow {
+		list, get = unix.Llistxattr, unix.Lgetxattr
+	}
+
+	names, err := readXattrValue(func(dest []byte) (int, error) { return list(pth, dest) })
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the extended attributes of %s: %s", pth, err)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	xattrs := map[string][]byte{}
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		value, err := readXattrValue(func(dest []byte) (int, error) { return get(pth, string(name), dest) })
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the %s extended attribute of %s: %s", name, pth, err)
+		}
+		xattrs[string(name)] = value
+	}
+
+	return xattrs, nil
+}
+
+// readXattrValue calls read with a nil buffer to get the size, then with a buffer of that size.
+// The attribute may grow in between, the read is retried with the new size.
+func readXattrValue(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		dest := make([]byte, size)
+		n, err := read(dest)
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dest[:n], nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package main
+
+// readXattrs is a no-op on non macOS systems, extended attributes are only preserved on macOS.
+func readXattrs(string, bool) (map[string][]byte, error) {
+	return nil, nil
+}
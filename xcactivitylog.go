@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// An .xcactivitylog is a gzip compressed SLF (Serialized Log Format) document: an `SLF0` header, followed by tokens.
+// Every token is a prefix followed by its type character:
+//
+//	12#        integer 12
+//	<hex>^     double, the hexadecimal representation of its little-endian bytes
+//	-          null
+//	5"Hello    string of 5 bytes (JSON data uses `*` instead of `"`)
+//	3(         list of 3 elements
+//	21%Name    class name definition (21 bytes)
+//	1@         instance of the first defined class, followed by its fields
+const (
+	slfInt       = '#'
+	slfDouble    = '^'
+	slfNull      = '-'
+	slfString    = '"'
+	slfJSON      = '*'
+	slfList      = '('
+	slfClassName = '%'
+	slfClassRef  = '@'
+)
+
+// slfReferenceDate is the reference date of the SLF timestamps (the Core Foundation absolute time).
+var slfReferenceDate = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type slfToken struct {
+	Type   byte
+	Int    uint64
+	Double float64
+	// String is the value of string and JSON tokens, and the class name of class instance tokens.
+	String string
+}
+
+// tokenizeSLF splits an SLF document into tokens, the class name definitions are resolved into the class instance tokens.
+func tokenizeSLF(content []byte) ([]slfToken, error) {
+	if !bytes.HasPrefix(content, []byte("SLF0")) {
+		return nil, fmt.Errorf("not an SLF document")
+	}
+
+	var tokens []slfToken
+	var classNames []string
+	start := 4
+	for pos := start; pos < len(content); {
+		c := content[pos]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') {
+			pos++
+			continue
+		}
+
+		prefix := string(content[start:pos])
+		pos++
+
+		switch c {
+		case slfInt, slfList:
+			value, err := strconv.ParseUint(prefix, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %q token at offset %d: %s", c, start, err)
+			}
+			tokens = append(tokens, slfToken{Type: c, Int: value})
+		case slfDouble:
+			b, err := hex.DecodeString(prefix)
+			if err != nil || len(b) != 8 {
+				return nil, fmt.Errorf("invalid double token at offset %d", start)
+			}
+			tokens = append(tokens, slfToken{Type: c, Double: math.Float64frombits(binary.LittleEndian.Uint64(b))})
+		case slfNull:
+			tokens = append(tokens, slfToken{Type: c})
+		case slfString, slfJSON, slfClassName:
+			length, err := strconv.Atoi(prefix)
+			if err != nil || pos+length > len(content) {
+				return nil, fmt.Errorf("invalid %q token at offset %d", c, start)
+			}
+			value := string(content[pos : pos+length])
+			pos += length
+
+			if c == slfClassName {
+				classNames = append(classNames, value)
+			} else {
+				tokens = append(tokens, slfToken{Type: c, String: value})
+			}
+		case slfClassRef:
+			index, err := strconv.Atoi(prefix)
+			if err != nil || index < 1 || index > len(classNames) {
+				return nil, fmt.Errorf("invalid class reference %q at offset %d", prefix, start)
+			}
+			tokens = append(tokens, slfToken{Type: c, String: classNames[index-1]})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, pos-1)
+		}
+
+		start = pos
+	}
+
+	return tokens, nil
+}
+
+// activityLogSection is a section of the build log: the build itself, a target or a build step (e.g. compiling a file).
+type activityLogSection struct {
+	DomainType          string
+	Title               string
+	Signature           string
+	Started             time.Time
+	Stopped             time.Time
+	Subsections         []activityLogSection
+	WasFetchedFromCache bool
+}
+
+// Duration returns the time the section was recorded for.
+func (s activityLogSection) Duration() time.Duration {
+	return s.Stopped.Sub(s.Started)
+}
+
+// slfParser reads the objects of an xcactivitylog, the field layout follows Xcode's IDEActivityLog classes.
+// The first error is kept, the reader methods return zero values after it.
+type slfParser struct {
+	tokens  []slfToken
+	pos     int
+	version uint64
+	err     error
+}
+
+func (p *slfParser) next() slfToken {
+	if p.err != nil {
+		return slfToken{}
+	}
+	if p.pos >= len(p.tokens) {
+		p.err = fmt.Errorf("unexpected end of the log")
+		return slfToken{}
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *slfParser) peek() (slfToken, bool) {
+	if p.err != nil || p.pos >= len(p.tokens) {
+		return slfToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *slfParser) unexpected(expected string, token slfToken) {
+	if p.err == nil {
+		p.err = fmt.Errorf("expected %s, got a %q token at token %d", expected, token.Type, p.pos-1)
+	}
+}
+
+func (p *slfParser) string() string {
+	token := p.next()
+	switch token.Type {
+	case slfString, slfJSON:
+		return token.String
+	case slfNull:
+		return ""
+	}
+	p.unexpected("string", token)
+	return ""
+}
+
+func (p *slfParser) number() float64 {
+	token := p.next()
+	switch token.Type {
+	case slfInt:
+		return float64(token.Int)
+	case slfDouble:
+		return token.Double
+	}
+	p.unexpected("number", token)
+	return 0
+}
+
+func (p *slfParser) time() time.Time {
+	seconds := p.number()
+	return slfReferenceDate.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+func (p *slfParser) list() int {
+	token := p.next()
+	switch token.Type {
+	case slfList:
+		return int(token.Int)
+	case slfNull:
+		return 0
+	}
+	p.unexpected("list", token)
+	return 0
+}
+
+// object returns the class name of the next object, or an empty string for null.
+func (p *slfParser) object() string {
+	token := p.next()
+	switch token.Type {
+	case slfClassRef:
+		return token.String
+	case slfNull:
+		return ""
+	}
+	p.unexpected("object", token)
+	return ""
+}
+
+func (p *slfParser) strings(n int) {
+	for i := 0; i < n; i++ {
+		p.string()
+	}
+}
+
+func (p *slfParser) numbers(n int) {
+	for i := 0; i < n; i++ {
+		p.number()
+	}
+}
+
+// section reads an IDEActivityLogSection (or one of its subclasses).
+func (p *slfParser) section(class string) activityLogSection {
+	var section activityLogSection
+	p.number() // sectionType
+	section.DomainType = p.string()
+	section.Title = p.string()
+	section.Signature = p.string()
+	section.Started = p.time()
+	section.Stopped = p.time()
+
+	count := p.list()
+	for i := 0; i < count && p.err == nil; i++ {
+		section.Subsections = append(section.Subsections, p.section(p.object()))
+	}
+
+	p.string() // text
+	p.messages()
+	p.numbers(2) // wasCancelled, isQuiet
+	section.WasFetchedFromCache = p.number() != 0
+	p.string() // subtitle
+	p.location(p.object())
+	p.strings(4) // commandDetailDesc, uniqueIdentifier, localizedResultString, xcbuildSignature
+
+	if p.version >= 11 {
+		p.attachments()
+		if token, ok := p.peek(); ok && token.Type == slfInt {
+			p.number() // unitTestSubsectionCount
+		}
+	}
+	if strings.HasSuffix(class, "UnitTestSection") {
+		p.strings(6) // testsPassedString, durationString, summaryString, suiteName, testName, performanceTestOutputString
+	}
+
+	return section
+}
+
+// messages reads a list of IDEActivityLogMessage (or subclass) objects, the messages are not used.
+func (p *slfParser) messages() {
+	count := p.list()
+	for i := 0; i < count && p.err == nil; i++ {
+		class := p.object()
+
+		p.strings(2) // title, shortTitle
+		p.numbers(3) // timeEmitted, rangeEndInSectionText, rangeStartInSectionText
+		p.messages() // subMessages
+		p.number()   // severity
+		p.string()   // type
+		p.location(p.object())
+		p.string() // categoryIdent
+		for j, locations := 0, p.list(); j < locations && p.err == nil; j++ {
+			p.location(p.object()) // secondaryLocations
+		}
+		p.string() // additionalDescription
+
+		switch class {
+		case "IDEActivityLogAnalyzerResultMessage":
+			p.string() // resultType
+			p.number() // keyEventIndex
+		case "IDEActivityLogAnalyzerControlFlowStepMessage":
+			p.number()             // parentIndex
+			p.location(p.object()) // endLocation
+			for j, edges := 0, p.list(); j < edges && p.err == nil; j++ {
+				p.object()
+				p.location(p.object()) // startLocation
+				p.location(p.object()) // endLocation
+			}
+		case "IDEActivityLogAnalyzerEventStepMessage":
+			p.number() // parentIndex
+			p.string() // description
+			p.number() // callDepth
+		case "IDEActivityLogActionMessage":
+			p.string() // action
+		}
+	}
+}
+
+// location reads the fields of a DVTDocumentLocation (or subclass) object.
+func (p *slfParser) location(class string) {
+	if class == "" {
+		return
+	}
+
+	p.string() // documentURLString
+	p.number() // timestamp
+
+	switch class {
+	case "DVTTextDocumentLocation":
+		p.numbers(7) // starting and ending line and column numbers, characterRangeEnd, characterRangeStart, locationEncoding
+	case "DVTMemberDocumentLocation":
+		p.string() // member
+	default:
+		// Other locations have numeric fields only.
+		for token, ok := p.peek(); ok && (token.Type == slfInt || token.Type == slfDouble); token, ok = p.peek() {
+			p.number()
+		}
+	}
+}
+
+// attachments reads a list of IDEActivityLogSectionAttachment objects.
+func (p *slfParser) attachments() {
+	count := p.list()
+	for i := 0; i < count && p.err == nil; i++ {
+		p.object()
+		p.string()   // identifier
+		p.numbers(2) // majorVersion, minorVersion
+		p.string()   // data
+	}
+}
+
+// parseActivityLog returns the root section of the SLF document.
+func parseActivityLog(content []byte) (activityLogSection, error) {
+	tokens, err := tokenizeSLF(content)
+	if err != nil {
+		return activityLogSection{}, err
+	}
+
+	p := &slfParser{tokens: tokens}
+	p.version = uint64(p.number())
+	root := p.section(p.object())
+	if p.err != nil {
+		return activityLogSection{}, fmt.Errorf("failed to parse the activity log (version %d): %s", p.version, p.err)
+	}
+	return root, nil
+}
+
+// readActivityLog decompresses and parses the .xcactivitylog.
+func readActivityLog(pth string) (activityLogSection, error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		return activityLogSection{}, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", pth, err)
+		}
+	}()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return activityLogSection{}, fmt.Errorf("failed to decompress %s: %s", pth, err)
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return activityLogSection{}, fmt.Errorf("failed to decompress %s: %s", pth, err)
+	}
+
+	return parseActivityLog(content)
+}
+
+// findActivityLog returns the newest build log modified since the given time, in the derived data directory
+// (`<derived data>/Logs/Build`) or in the project directories of the default derived data directory
+// (`<derived data>/<project>-<hash>/Logs/Build`).
+func findActivityLog(derivedDataDir string, since time.Time) (string, error) {
+	var pths []string
+	for _, pattern := range []string{
+		filepath.Join(derivedDataDir, "Logs", "Build", "*.xcactivitylog"),
+		filepath.Join(derivedDataDir, "*", "Logs", "Build", "*.xcactivitylog"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		pths = append(pths, matches...)
+	}
+
+	newest := ""
+	var newestModTime time.Time
+	for _, pth := range pths {
+		info, err := os.Stat(pth)
+		if err != nil {
+			return "", err
+		}
+		if info.ModTime().Before(since) {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestModTime) {
+			newest = pth
+			newestModTime = info.ModTime()
+		}
+	}
+
+	if newest == "" {
+		return "", fmt.Errorf("no build log modified since %s found in %s", since.Format(time.RFC3339), derivedDataDir)
+	}
+	return newest, nil
+}
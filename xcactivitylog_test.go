@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slfEncoder writes SLF documents for the tests.
+type slfEncoder struct {
+	strings.Builder
+	classes []string
+}
+
+func (e *slfEncoder) int(v uint64) { fmt.Fprintf(e, "%d#", v) }
+
+func (e *slfEncoder) double(v float64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	fmt.Fprintf(e, "%s^", hex.EncodeToString(b))
+}
+
+func (e *slfEncoder) null() { e.WriteString("-") }
+
+func (e *slfEncoder) string(s string) { fmt.Fprintf(e, "%d\"%s", len(s), s) }
+
+func (e *slfEncoder) list(n int) { fmt.Fprintf(e, "%d(", n) }
+
+func (e *slfEncoder) object(class string) {
+	for i, c := range e.classes {
+		if c == class {
+			fmt.Fprintf(e, "%d@", i+1)
+			return
+		}
+	}
+	e.classes = append(e.classes, class)
+	fmt.Fprintf(e, "%d%%%s%d@", len(class), class, len(e.classes))
+}
+
+type testSection struct {
+	domainType, title, signature string
+	started, stopped             float64
+	cached                       bool
+	withMessage                  bool
+	subsections                  []testSection
+}
+
+// section writes an IDEActivityLogSection of a version 11 log.
+func (e *slfEncoder) section(s testSection) {
+	e.object("IDEActivityLogSection")
+	e.int(2)
+	e.string(s.domainType)
+	e.string(s.title)
+	e.string(s.signature)
+	e.double(s.started)
+	e.double(s.stopped)
+	e.list(len(s.subsections))
+	for _, subsection := range s.subsections {
+		e.section(subsection)
+	}
+	e.null() // text
+
+	if s.withMessage {
+		e.list(1)
+		e.object("IDEClangDiagnosticActivityLogMessage")
+		e.string("'count' was never used")
+		e.null()
+		e.int(0)
+		e.int(18446744073709551615)
+		e.int(18446744073709551615)
+		e.list(0)
+		e.int(1)
+		e.string("com.apple.dt.IDE.diagnostic")
+		e.object("DVTTextDocumentLocation")
+		e.string("file:///work/App/AppDelegate.swift")
+		e.double(0)
+		for i := 0; i < 7; i++ {
+			e.int(uint64(i))
+		}
+		e.null()
+		e.list(0)
+		e.null()
+	} else {
+		e.list(0)
+	}
+
+	e.int(0) // wasCancelled
+	e.int(0) // isQuiet
+	if s.cached {
+		e.int(1)
+	} else {
+		e.int(0)
+	}
+	e.null() // subtitle
+	e.null() // location
+	e.string(s.signature)
+	e.string("uid")
+	e.null()
+	e.null()
+
+	if s.title == "Build App" {
+		e.list(1)
+		e.object("IDEFoundation.IDEActivityLogSectionAttachment")
+		e.string("com.apple.dt.ActivityLogSectionAttachment.TaskMetrics")
+		e.int(1)
+		e.int(0)
+		fmt.Fprintf(e, "%d*%s", len(`{"wcDuration":1}`), `{"wcDuration":1}`)
+	} else {
+		e.list(0)
+	}
+	e.int(0) // unitTestSubsectionCount
+}
+
+var testBuildLog = testSection{
+	domainType: "Xcode.IDEActivityLogDomainType.BuildLog",
+	title:      "Build App",
+	started:    100,
+	stopped:    160,
+	subsections: []testSection{
+		{domainType: "com.apple.dt.IDE.BuildLogSection", title: "Prepare build", started: 100, stopped: 100.5},
+		{
+			domainType: "Xcode.IDEActivityLogDomainType.target.product-type.app-extension",
+			title:      "Build target Widget of project App with configuration Release",
+			started:    100.5,
+			stopped:    110.5,
+			subsections: []testSection{
+				{title: "Compile Widget.swift (arm64)", signature: "SwiftCompile normal arm64 /work/Widget/Widget.swift", started: 101, stopped: 109, cached: true},
+			},
+		},
+		{
+			domainType: "Xcode.IDEActivityLogDomainType.target.product-type.application",
+			title:      "Build target App of project App with configuration Release",
+			started:    110.5,
+			stopped:    160,
+			subsections: []testSection{
+				{title: "Run custom shell script 'SwiftLint'", signature: "PhaseScriptExecution SwiftLint /work/build/Script-1.sh", started: 110.5, stopped: 122.75},
+				{
+					title:     "Compile Swift source files (arm64)",
+					signature: "CompileSwiftSources normal arm64 com.apple.xcode.tools.swift.compiler",
+					started:   123,
+					stopped:   150,
+					subsections: []testSection{
+						{title: "Compile AppDelegate.swift (arm64)", signature: "CompileSwift normal arm64 /work/App/AppDelegate.swift", started: 123, stopped: 148, withMessage: true},
+						{title: "Compile ContentView.swift (arm64)", signature: "CompileSwift normal arm64 /work/App/ContentView.swift", started: 123, stopped: 125.5},
+					},
+				},
+				{title: "Link App (arm64)", signature: "Ld /work/build/App.app/Contents/MacOS/App normal", started: 150, stopped: 159.5},
+			},
+		},
+	},
+}
+
+func writeActivityLog(t *testing.T, pth string, root testSection) {
+	e := &slfEncoder{}
+	e.WriteString("SLF0")
+	e.int(11)
+	e.section(root)
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(e.String())); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, pth, buf.String())
+}
+
+func TestTokenizeSLF(t *testing.T) {
+	e := &slfEncoder{}
+	e.WriteString("SLF0")
+	e.int(11)
+	e.object("IDEActivityLogSection")
+	e.double(1.5)
+	e.null()
+	e.string("Build App")
+	e.list(2)
+	e.object("IDEActivityLogSection")
+
+	tokens, err := tokenizeSLF([]byte(e.String()))
+	if err != nil {
+		t.Fatalf("tokenizeSLF() error = %s", err)
+	}
+
+	want := []slfToken{
+		{Type: slfInt, Int: 11},
+		{Type: slfClassRef, String: "IDEActivityLogSection"},
+		{Type: slfDouble, Double: 1.5},
+		{Type: slfNull},
+		{Type: slfString, String: "Build App"},
+		{Type: slfList, Int: 2},
+		{Type: slfClassRef, String: "IDEActivityLogSection"},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("tokenizeSLF() returned %d tokens, want %d: %+v", len(tokens), len(want), tokens)
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("token[%d] = %+v, want %+v", i, tokens[i], want[i])
+		}
+	}
+
+	if _, err := tokenizeSLF([]byte("SLF03@")); err == nil {
+		t.Errorf("tokenizeSLF() expected error for an undefined class reference")
+	}
+	if _, err := tokenizeSLF([]byte("<?xml")); err == nil {
+		t.Errorf("tokenizeSLF() expected error for a non SLF document")
+	}
+}
+
+func TestReadActivityLog(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "build.xcactivitylog")
+	writeActivityLog(t, pth, testBuildLog)
+
+	root, err := readActivityLog(pth)
+	if err != nil {
+		t.Fatalf("readActivityLog() error = %s", err)
+	}
+
+	if root.Title != "Build App" || root.Duration() != time.Minute {
+		t.Errorf("root = %s (%s), want Build App (1m0s)", root.Title, root.Duration())
+	}
+	if !root.Started.Equal(slfReferenceDate.Add(100 * time.Second)) {
+		t.Errorf("Started = %s", root.Started)
+	}
+	if len(root.Subsections) != 3 {
+		t.Fatalf("got %d subsections, want 3", len(root.Subsections))
+	}
+
+	widget := root.Subsections[1].Subsections[0]
+	if widget.Signature != "SwiftCompile normal arm64 /work/Widget/Widget.swift" || !widget.WasFetchedFromCache {
+		t.Errorf("widget step = %+v, want a cached SwiftCompile step", widget)
+	}
+
+	compileSources := root.Subsections[2].Subsections[1]
+	if len(compileSources.Subsections) != 2 || compileSources.Subsections[1].Title != "Compile ContentView.swift (arm64)" {
+		t.Errorf("compile sources = %+v", compileSources)
+	}
+}
+
+func TestParseActivityLogTruncated(t *testing.T) {
+	e := &slfEncoder{}
+	e.WriteString("SLF0")
+	e.int(11)
+	e.object("IDEActivityLogSection")
+	e.int(2)
+	e.string("Xcode.IDEActivityLogDomainType.BuildLog")
+
+	_, err := parseActivityLog([]byte(e.String()))
+	if err == nil || !strings.Contains(err.Error(), "unexpected end of the log") {
+		t.Errorf("parseActivityLog() error = %v, want unexpected end of the log", err)
+	}
+}
+
+func TestFindActivityLog(t *testing.T) {
+	derivedDataDir := t.TempDir()
+	oldLog := filepath.Join(derivedDataDir, "App-abc", "Logs", "Build", "old.xcactivitylog")
+	newLog := filepath.Join(derivedDataDir, "App-abc", "Logs", "Build", "new.xcactivitylog")
+	writeFile(t, oldLog, "")
+	writeFile(t, newLog, "")
+
+	archiveStarted := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(oldLog, archiveStarted.Add(-time.Hour), archiveStarted.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := findActivityLog(derivedDataDir, archiveStarted)
+	if err != nil {
+		t.Fatalf("findActivityLog() error = %s", err)
+	}
+	if got != newLog {
+		t.Errorf("findActivityLog() = %s, want %s", got, newLog)
+	}
+
+	if _, err := findActivityLog(derivedDataDir, time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("findActivityLog() expected error when no log was written since the archive started")
+	}
+}
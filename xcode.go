@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-xcode/plistutil"
+	"github.com/hashicorp/go-version"
+)
+
+// xcodeSearchPattern matches the Xcode installations, e.g. /Applications/Xcode.app and /Applications/Xcode_15.2.app.
+const xcodeSearchPattern = "/Applications/Xcode*.app"
+
+// xcodeCapability is a feature of the Xcode tools the Step relies on.
+type xcodeCapability string
+
+const (
+	xcodeCapabilityExportOptionsPlist           xcodeCapability = "export options plist"
+	xcodeCapabilityProvisioningProfileSpecifier xcodeCapability = "PROVISIONING_PROFILE_SPECIFIER build setting"
+	xcodeCapabilityDevelopmentTeam              xcodeCapability = "DEVELOPMENT_TEAM build setting"
+	xcodeCapabilityResultBundle                 xcodeCapability = "result bundle"
+	xcodeCapabilityLegacyXCResultTool           xcodeCapability = "xcresulttool --legacy flag"
+)
+
+// xcodeCapabilities are the Xcode major versions introducing the capabilities.
+var xcodeCapabilities = map[xcodeCapability]int64{
+	xcodeCapabilityExportOptionsPlist:           7,
+	xcodeCapabilityProvisioningProfileSpecifier: 8,
+	xcodeCapabilityDevelopmentTeam:              8,
+	xcodeCapabilityResultBundle:                 11,
+	xcodeCapabilityLegacyXCResultTool:           16,
+}
+
+// xcodeSupports returns true if the given Xcode major version has the capability.
+func xcodeSupports(majorVersion int64, capability xcodeCapability) bool {
+	return majorVersion >= xcodeCapabilities[capability]
+}
+
+// xcodeInstallation is an installed Xcode.
+type xcodeInstallation struct {
+	// Path is the Xcode .app.
+	Path         string
+	Version      *version.Version
+	BuildVersion string
+}
+
+// DeveloperDir returns the value of the DEVELOPER_DIR environment variable selecting the installation.
+func (x xcodeInstallation) DeveloperDir() string {
+	return filepath.Join(x.Path, "Contents", "Developer")
+}
+
+func (x xcodeInstallation) String() string {
+	return fmt.Sprintf("%s (%s) at %s", x.Version, x.BuildVersion, x.Path)
+}
+
+// readXcodeInstallation reads the version of the Xcode .app from its Contents/version.plist.
+func readXcodeInstallation(pth string) (xcodeInstallation, error) {
+	versionPlist, err := plistutil.NewPlistDataFromFile(filepath.Join(pth, "Contents", "version.plist"))
+	if err != nil {
+		return xcodeInstallation{}, err
+	}
+
+	shortVersion, ok := versionPlist.GetString("CFBundleShortVersionString")
+	if !ok {
+		return xcodeInstallation{}, fmt.Errorf("no CFBundleShortVersionString in the version.plist of %s", pth)
+	}
+	xcodeVersion, err := version.NewVersion(shortVersion)
+	if err != nil {
+		return xcodeInstallation{}, fmt.Errorf("invalid Xcode version (%s) of %s: %s", shortVersion, pth, err)
+	}
+	buildVersion, _ := versionPlist.GetString("ProductBuildVersion")
+
+	return xcodeInstallation{Path: pth, Version: xcodeVersion, BuildVersion: buildVersion}, nil
+}
+
+// findXcodeInstallations returns the Xcode installations matching the glob pattern.
+// The .app bundles without a readable version are skipped.
+func findXcodeInstallations(pattern string) ([]xcodeInstallation, error) {
+	pths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(pths)
+
+	var installations []xcodeInstallation
+	for _, pth := range pths {
+		installation, err := readXcodeInstallation(pth)
+		if err != nil {
+			continue
+		}
+		installations = append(installations, installation)
+	}
+	return installations, nil
+}
+
+// xcodeAppPath returns the Xcode .app of a DEVELOPER_DIR, which may point to the .app or its Contents/Developer directory.
+func xcodeAppPath(developerDir string) string {
+	pth := filepath.Clean(developerDir)
+	if filepath.Base(pth) == "Developer" && filepath.Base(filepath.Dir(pth)) == "Contents" {
+		return filepath.Dir(filepath.Dir(pth))
+	}
+	return pth
+}
+
+// selectXcode returns the Xcode to archive with.
+// An explicit DEVELOPER_DIR is used if it satisfies the constraint, otherwise the newest installation satisfying
+// the constraint is selected (a release is preferred over a beta of the same version).
+func selectXcode(constraint, developerDir string, installations []xcodeInstallation) (xcodeInstallation, error) {
+	var constraints version.Constraints
+	if constraint != "" {
+		var err error
+		if constraints, err = version.NewConstraint(constraint); err != nil {
+			return xcodeInstallation{}, fmt.Errorf("invalid Xcode version constraint (%s): %s", constraint, err)
+		}
+	}
+
+	if developerDir != "" {
+		appPath := xcodeAppPath(developerDir)
+		if _, err := os.Stat(appPath); err != nil {
+			return xcodeInstallation{}, fmt.Errorf("no Xcode found at the developer dir (%s): %s", developerDir, err)
+		}
+
+		installation, err := readXcodeInstallation(appPath)
+		if err != nil {
+			return xcodeInstallation{}, fmt.Errorf("failed to read the Xcode version at the developer dir (%s): %s", developerDir, err)
+		}
+		if constraints != nil && !constraints.Check(installation.Version) {
+			return xcodeInstallation{}, fmt.Errorf("the Xcode at the developer dir (%s) does not satisfy the version constraint (%s)", installation, constraint)
+		}
+		return installation, nil
+	}
+
+	var matching []xcodeInstallation
+	for _, installation := range installations {
+		if constraints.Check(installation.Version) {
+			matching = append(matching, installation)
+		}
+	}
+	if len(installations) == 0 {
+		return xcodeInstallation{}, fmt.Errorf("no Xcode installation found")
+	}
+	if len(matching) == 0 {
+		installed := make([]string, 0, len(installations))
+		for _, installation := range installations {
+			installed = append(installed, installation.String())
+		}
+		return xcodeInstallation{}, fmt.Errorf("no installed Xcode satisfies the version constraint (%s), installed Xcodes:\n- %s", constraint, strings.Join(installed, "\n- "))
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		if !matching[i].Version.Equal(matching[j].Version) {
+			return matching[i].Version.GreaterThan(matching[j].Version)
+		}
+		return !isBetaXcode(matching[i]) && isBetaXcode(matching[j])
+	})
+	return matching[0], nil
+}
+
+func isBetaXcode(installation xcodeInstallation) bool {
+	return strings.Contains(strings.ToLower(filepath.Base(installation.Path)), "beta")
+}
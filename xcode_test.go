@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func createXcode(t *testing.T, dir, name, shortVersion, buildVersion string) string {
+	pth := filepath.Join(dir, name)
+	writeFile(t, filepath.Join(pth, "Contents", "version.plist"), `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleShortVersionString</key>
+	<string>`+shortVersion+`</string>
+	<key>ProductBuildVersion</key>
+	<string>`+buildVersion+`</string>
+</dict>
+</plist>`)
+	return pth
+}
+
+func TestXcodeSupports(t *testing.T) {
+	tests := []struct {
+		majorVersion int64
+		capability   xcodeCapability
+		want         bool
+	}{
+		{majorVersion: 6, capability: xcodeCapabilityExportOptionsPlist, want: false},
+		{majorVersion: 7, capability: xcodeCapabilityExportOptionsPlist, want: true},
+		{majorVersion: 7, capability: xcodeCapabilityDevelopmentTeam, want: false},
+		{majorVersion: 15, capability: xcodeCapabilityDevelopmentTeam, want: true},
+		{majorVersion: 15, capability: xcodeCapabilityProvisioningProfileSpecifier, want: true},
+	}
+	for _, tt := range tests {
+		if got := xcodeSupports(tt.majorVersion, tt.capability); got != tt.want {
+			t.Errorf("xcodeSupports(%d, %s) = %v, want %v", tt.majorVersion, tt.capability, got, tt.want)
+		}
+	}
+}
+
+func TestSelectXcode(t *testing.T) {
+	dir := t.TempDir()
+	createXcode(t, dir, "Xcode_15.0.app", "15.0", "15A240d")
+	xcode152 := createXcode(t, dir, "Xcode_15.2.app", "15.2", "15C500b")
+	xcode16Beta := createXcode(t, dir, "Xcode-beta.app", "16.0", "16A5171c")
+	xcode16 := createXcode(t, dir, "Xcode.app", "16.0", "16A242d")
+	writeFile(t, filepath.Join(dir, "Xcode_broken.app", "Contents", "Info.plist"), "")
+
+	installations, err := findXcodeInstallations(filepath.Join(dir, "Xcode*.app"))
+	if err != nil {
+		t.Fatalf("findXcodeInstallations() error = %s", err)
+	}
+	if len(installations) != 4 {
+		t.Fatalf("findXcodeInstallations() returned %d installations, want 4", len(installations))
+	}
+
+	tests := []struct {
+		name         string
+		constraint   string
+		developerDir string
+		want         string
+		wantErr      string
+	}{
+		{name: "newest", constraint: "", want: xcode16},
+		{name: "newest matching", constraint: ">= 15.1, < 16", want: xcode152},
+		{name: "pessimistic", constraint: "~> 15.0", want: xcode152},
+		{name: "release over beta", constraint: "= 16.0", want: xcode16},
+		{name: "developer dir", developerDir: filepath.Join(xcode16Beta, "Contents", "Developer"), want: xcode16Beta},
+		{name: "developer dir not matching", constraint: "< 16", developerDir: xcode16, wantErr: "does not satisfy the version constraint (< 16)"},
+		{name: "none matching", constraint: ">= 17", wantErr: "no installed Xcode satisfies the version constraint (>= 17)"},
+		{name: "invalid constraint", constraint: "latest", wantErr: "invalid Xcode version constraint (latest)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectXcode(tt.constraint, tt.developerDir, installations)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectXcode() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectXcode() error = %s", err)
+			}
+			if got.Path != tt.want {
+				t.Errorf("selectXcode() = %s, want %s", got.Path, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-xcode/xcodeproject/serialized"
+	"howett.net/plist"
+)
+
+const (
+	productTypeApplication  = "com.apple.product-type.application"
+	productTypeAppExtension = "com.apple.product-type.app-extension"
+	productTypeExtensionKit = "com.apple.product-type.extensionkit-extension"
+	productTypeXPCService   = "com.apple.product-type.xpc-service"
+)
+
+// signingBuildSettingKeys are the build settings describing how a target is code signed.
+var signingBuildSettingKeys = []string{
+	"CODE_SIGN_STYLE",
+	"CODE_SIGN_IDENTITY",
+	"CODE_SIGN_ENTITLEMENTS",
+	"DEVELOPMENT_TEAM",
+	"PROVISIONING_PROFILE_SPECIFIER",
+	"PROVISIONING_PROFILE",
+}
+
+// xcodeProject is the content of an .xcodeproj's project.pbxproj, parsed without invoking xcodebuild.
+// Build settings coming from .xcconfig files are not resolved.
+type xcodeProject struct {
+	Path                string
+	BuildConfigurations []string
+	Targets             []xcodeTarget
+	// PackageReferences are the repository URLs of the remote and the paths of the local Swift packages.
+	PackageReferences []string
+}
+
+// xcodeTarget is a native target of a project.
+type xcodeTarget struct {
+	ID                 string
+	Name               string
+	ProductType        string
+	DependentTargetIDs []string
+	// BuildSettings holds the target's build settings per build configuration name,
+	// the project level build settings are merged in and substituted for `$(inherited)`.
+	BuildSettings map[string]serialized.Object
+}
+
+// Name returns the project's name, without the .xcodeproj extension.
+func (p xcodeProject) Name() string {
+	return strings.TrimSuffix(filepath.Base(p.Path), filepath.Ext(p.Path))
+}
+
+// HasBuildConfiguration returns true if the project defines the named build configuration.
+func (p xcodeProject) HasBuildConfiguration(name string) bool {
+	for _, configuration := range p.BuildConfigurations {
+		if configuration == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Target returns the target with the given ID.
+func (p xcodeProject) Target(id string) (xcodeTarget, bool) {
+	for _, target := range p.Targets {
+		if target.ID == id {
+			return target, true
+		}
+	}
+	return xcodeTarget{}, false
+}
+
+// EmbeddedExtensions returns the app extension and XPC service targets the given target depends on.
+func (p xcodeProject) EmbeddedExtensions(target xcodeTarget) []xcodeTarget {
+	var extensions []xcodeTarget
+	for _, id := range target.DependentTargetIDs {
+		dependency, ok := p.Target(id)
+		if !ok {
+			continue
+		}
+		switch dependency.ProductType {
+		case productTypeAppExtension, productTypeExtensionKit, productTypeXPCService:
+			extensions = append(extensions, dependency)
+		}
+	}
+	return extensions
+}
+
+// InfoPlistPath returns the absolute path of the target's INFOPLIST_FILE for the given configuration,
+// or an empty string if the target's Info.plist is generated from the build settings.
+func (p xcodeProject) InfoPlistPath(target xcodeTarget, configuration string) string {
+	settings, ok := target.BuildSettings[configuration]
+	if !ok {
+		return ""
+	}
+
+	projectDir, err := filepath.Abs(filepath.Dir(p.Path))
+	if err != nil {
+		return ""
+	}
+
+	pth := expandBuildSettingReferences(target.rawBuildSetting(settings, "INFOPLIST_FILE"), func(name string) string {
+		switch name {
+		case "SRCROOT", "PROJECT_DIR", "SOURCE_ROOT":
+			return projectDir
+		}
+		return target.rawBuildSetting(settings, name)
+	}, 0)
+	if pth == "" {
+		return ""
+	}
+
+	if !filepath.IsAbs(pth) {
+		pth = filepath.Join(projectDir, pth)
+	}
+	return pth
+}
+
+// BuildSetting returns the value of the build setting for the given configuration, with the
+// build setting references (e.g. `$(PRODUCT_NAME:rfc1034identifier)`) expanded.
+// A macOS SDK conditional value (`KEY[sdk=macosx*]`) takes precedence over the unconditional one.
+func (t xcodeTarget) BuildSetting(configuration, key string) string {
+	settings, ok := t.BuildSettings[configuration]
+	if !ok {
+		return ""
+	}
+	return expandBuildSettingReferences(t.rawBuildSetting(settings, key), func(name string) string {
+		return t.rawBuildSetting(settings, name)
+	}, 0)
+}
+
+func (t xcodeTarget) rawBuildSetting(settings serialized.Object, key string) string {
+	for _, k := range []string{key + "[sdk=macosx*]", key} {
+		if value, err := settings.String(k); err == nil {
+			return value
+		}
+		if values, err := settings.StringSlice(k); err == nil {
+			return strings.Join(values, " ")
+		}
+	}
+
+	switch key {
+	case "TARGET_NAME":
+		return t.Name
+	case "PRODUCT_NAME":
+		return t.Name
+	}
+	return ""
+}
+
+// BundleID returns the target's PRODUCT_BUNDLE_IDENTIFIER for the given configuration.
+func (t xcodeTarget) BundleID(configuration string) string {
+	return t.BuildSetting(configuration, "PRODUCT_BUNDLE_IDENTIFIER")
+}
+
+// SigningSettings returns the target's code signing related build settings for the given configuration.
+func (t xcodeTarget) SigningSettings(configuration string) map[string]string {
+	settings := map[string]string{}
+	for _, key := range signingBuildSettingKeys {
+		if value := t.BuildSetting(configuration, key); value != "" {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// IsApplication returns true if the target builds an application.
+func (t xcodeTarget) IsApplication() bool {
+	return t.ProductType == productTypeApplication
+}
+
+var buildSettingReferencePattern = regexp.MustCompile(`\$[({]([A-Za-z0-9_]+)(?::([A-Za-z0-9_,]+))?[)}]`)
+var nonRFC1034Characters = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+var nonIdentifierCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// inheritedReferencePattern matches `$(inherited)`, the value of the setting at the enclosing (project) level.
+var inheritedReferencePattern = regexp.MustCompile(`\$[({]inherited[)}]`)
+
+func expandBuildSettingReferences(value string, lookup func(string) string, depth int) string {
+	if depth > 10 {
+		return value
+	}
+
+	return buildSettingReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		match := buildSettingReferencePattern.FindStringSubmatch(reference)
+		expanded := expandBuildSettingReferences(lookup(match[1]), lookup, depth+1)
+
+		for _, modifier := range strings.Split(match[2], ",") {
+			switch modifier {
+			case "rfc1034identifier":
+				expanded = nonRFC1034Characters.ReplaceAllString(expanded, "-")
+			case "c99extidentifier", "identifier":
+				expanded = nonIdentifierCharacters.ReplaceAllString(expanded, "_")
+			case "lower":
+				expanded = strings.ToLower(expanded)
+			case "upper":
+				expanded = strings.ToUpper(expanded)
+			}
+		}
+		return expanded
+	})
+}
+
+// openXcodeProject parses the project.pbxproj of the given .xcodeproj.
+func openXcodeProject(pth string) (xcodeProject, error) {
+	content, err := os.ReadFile(filepath.Join(pth, "project.pbxproj"))
+	if err != nil {
+		return xcodeProject{}, err
+	}
+
+	project, err := parseXcodeProject(content)
+	if err != nil {
+		return xcodeProject{}, fmt.Errorf("failed to parse %s: %s", pth, err)
+	}
+	project.Path = pth
+
+	return project, nil
+}
+
+func parseXcodeProject(content []byte) (xcodeProject, error) {
+	var raw map[string]interface{}
+	if _, err := plist.Unmarshal(content, &raw); err != nil {
+		return xcodeProject{}, err
+	}
+	pbxproj := serialized.Object(raw)
+
+	objects, err := pbxproj.Object("objects")
+	if err != nil {
+		return xcodeProject{}, err
+	}
+	rootObjectID, err := pbxproj.String("rootObject")
+	if err != nil {
+		return xcodeProject{}, err
+	}
+	rootObject, err := objects.Object(rootObjectID)
+	if err != nil {
+		return xcodeProject{}, err
+	}
+
+	projectConfigurations, err := buildConfigurations(objects, rootObject)
+	if err != nil {
+		return xcodeProject{}, fmt.Errorf("failed to read project build configurations: %s", err)
+	}
+
+	var project xcodeProject
+	for name := range projectConfigurations {
+		project.BuildConfigurations = append(project.BuildConfigurations, name)
+	}
+	sort.Strings(project.BuildConfigurations)
+
+	targetIDs, err := rootObject.StringSlice("targets")
+	if err != nil {
+		return xcodeProject{}, err
+	}
+
+	for _, targetID := range targetIDs {
+		targetObject, err := objects.Object(targetID)
+		if err != nil {
+			return xcodeProject{}, err
+		}
+		if isa, _ := targetObject.String("isa"); isa != "PBXNativeTarget" {
+			continue
+		}
+
+		target, err := parseXcodeTarget(objects, targetID, targetObject, projectConfigurations)
+		if err != nil {
+			return xcodeProject{}, err
+		}
+		project.Targets = append(project.Targets, target)
+	}
+
+	for _, id := range objects.Keys() {
+		object, err := objects.Object(id)
+		if err != nil {
+			continue
+		}
+		switch isa, _ := object.String("isa"); isa {
+		case "XCRemoteSwiftPackageReference":
+			if url, err := object.String("repositoryURL"); err == nil {
+				project.PackageReferences = append(project.PackageReferences, url)
+			}
+		case "XCLocalSwiftPackageReference":
+			if pth, err := object.String("relativePath"); err == nil {
+				project.PackageReferences = append(project.PackageReferences, pth)
+			}
+		}
+	}
+	sort.Strings(project.PackageReferences)
+
+	return project, nil
+}
+
+func parseXcodeTarget(objects serialized.Object, id string, targetObject serialized.Object, projectConfigurations map[string]serialized.Object) (xcodeTarget, error) {
+	name, err := targetObject.String("name")
+	if err != nil {
+		return xcodeTarget{}, err
+	}
+	productType, _ := targetObject.String("productType")
+
+	targetConfigurations, err := buildConfigurations(objects, targetObject)
+	if err != nil {
+		return xcodeTarget{}, fmt.Errorf("failed to read build configurations of target %s: %s", name, err)
+	}
+
+	settings := map[string]serialized.Object{}
+	for configuration, targetSettings := range targetConfigurations {
+		settings[configuration] = mergeBuildSettings(projectConfigurations[configuration], targetSettings)
+	}
+
+	var dependentTargetIDs []string
+	dependencyIDs, _ := targetObject.StringSlice("dependencies")
+	for _, dependencyID := range dependencyIDs {
+		dependency, err := objects.Object(dependencyID)
+		if err != nil {
+			return xcodeTarget{}, err
+		}
+		if targetID, err := dependency.String("target"); err == nil {
+			dependentTargetIDs = append(dependentTargetIDs, targetID)
+		}
+	}
+
+	return xcodeTarget{
+		ID:                 id,
+		Name:               name,
+		ProductType:        productType,
+		DependentTargetIDs: dependentTargetIDs,
+		BuildSettings:      settings,
+	}, nil
+}
+
+// mergeBuildSettings returns the project level build settings overridden by the target's,
+// `$(inherited)` in a target value is replaced by the project level value.
+func mergeBuildSettings(projectSettings, targetSettings serialized.Object) serialized.Object {
+	merged := serialized.Object{}
+	for key, value := range projectSettings {
+		merged[key] = value
+	}
+	for key, value := range targetSettings {
+		inherited, ok := projectSettings[key]
+		if !ok {
+			// A conditional setting (`KEY[sdk=macosx*]`) inherits the unconditional one.
+			inherited = projectSettings[strings.SplitN(key, "[", 2)[0]]
+		}
+		merged[key] = inheritBuildSetting(value, inherited)
+	}
+	return merged
+}
+
+// inheritBuildSetting replaces `$(inherited)` in the string or list value with the inherited value.
+func inheritBuildSetting(value, inherited interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(inheritedReferencePattern.ReplaceAllLiteralString(v, buildSettingString(inherited)))
+	case []interface{}:
+		var values []interface{}
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok || !inheritedReferencePattern.MatchString(str) {
+				values = append(values, item)
+				continue
+			}
+			if str = strings.TrimSpace(str); inheritedReferencePattern.FindString(str) == str {
+				// A list item of only `$(inherited)` is replaced by the inherited items.
+				if items, ok := inherited.([]interface{}); ok {
+					values = append(values, items...)
+				} else if inheritedStr := buildSettingString(inherited); inheritedStr != "" {
+					values = append(values, inheritedStr)
+				}
+				continue
+			}
+			values = append(values, inheritBuildSetting(str, inherited))
+		}
+		return values
+	}
+	return value
+}
+
+// buildSettingString returns the string or list value as a space separated string.
+func buildSettingString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				items = append(items, str)
+			}
+		}
+		return strings.Join(items, " ")
+	}
+	return ""
+}
+
+// buildConfigurations returns the build settings per configuration name of the object's XCConfigurationList.
+func buildConfigurations(objects, object serialized.Object) (map[string]serialized.Object, error) {
+	listID, err := object.String("buildConfigurationList")
+	if err != nil {
+		return nil, err
+	}
+	list, err := objects.Object(listID)
+	if err != nil {
+		return nil, err
+	}
+	configurationIDs, err := list.StringSlice("buildConfigurations")
+	if err != nil {
+		return nil, err
+	}
+
+	configurations := map[string]serialized.Object{}
+	for _, configurationID := range configurationIDs {
+		configuration, err := objects.Object(configurationID)
+		if err != nil {
+			return nil, err
+		}
+		name, err := configuration.String("name")
+		if err != nil {
+			return nil, err
+		}
+		settings, err := configuration.Object("buildSettings")
+		if err != nil && !serialized.IsKeyNotFoundError(err) {
+			return nil, err
+		}
+		configurations[name] = settings
+	}
+
+	return configurations, nil
+}
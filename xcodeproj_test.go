@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-xcode/xcodeproject/serialized"
+)
+
+func TestOpenXcodeProject(t *testing.T) {
+	project, err := openXcodeProject("testdata/App.xcodeproj")
+	if err != nil {
+		t.Fatalf("openXcodeProject() error = %s", err)
+	}
+
+	if got := project.Name(); got != "App" {
+		t.Errorf("Name() = %v, want App", got)
+	}
+	if want := []string{"Debug", "Release"}; !reflect.DeepEqual(project.BuildConfigurations, want) {
+		t.Errorf("BuildConfigurations = %v, want %v", project.BuildConfigurations, want)
+	}
+
+	if want := []string{"https://github.com/sparkle-project/Sparkle"}; !reflect.DeepEqual(project.PackageReferences, want) {
+		t.Errorf("PackageReferences = %v, want %v", project.PackageReferences, want)
+	}
+
+	app, ok := project.Target("A10000000000000000000002")
+	if !ok {
+		t.Fatalf("App target not found")
+	}
+	if !app.IsApplication() {
+		t.Errorf("IsApplication() = false, want true")
+	}
+
+	if got := app.BundleID("Release"); got != "io.bitrise.App" {
+		t.Errorf("BundleID(Release) = %v, want io.bitrise.App", got)
+	}
+	if got := app.BundleID("Debug"); got != "io.bitrise.App-Debug" {
+		t.Errorf("BundleID(Debug) = %v, want io.bitrise.App-Debug", got)
+	}
+
+	wantSigning := map[string]string{
+		"CODE_SIGN_STYLE":                "Manual",
+		"CODE_SIGN_IDENTITY":             "Developer ID Application",
+		"CODE_SIGN_ENTITLEMENTS":         "App/App.entitlements",
+		"DEVELOPMENT_TEAM":               "72SA8V3WYL",
+		"PROVISIONING_PROFILE_SPECIFIER": "App Developer ID",
+	}
+	if got := app.SigningSettings("Release"); !reflect.DeepEqual(got, wantSigning) {
+		t.Errorf("SigningSettings(Release) = %v, want %v", got, wantSigning)
+	}
+
+	extensions := project.EmbeddedExtensions(app)
+	if len(extensions) != 1 || extensions[0].Name != "Widget" {
+		t.Fatalf("EmbeddedExtensions() = %v, want [Widget]", extensions)
+	}
+	if got := extensions[0].BundleID("Release"); got != "io.bitrise.App.widget" {
+		t.Errorf("BundleID(Release) = %v, want io.bitrise.App.widget", got)
+	}
+}
+
+func TestExpandBuildSettingReferences(t *testing.T) {
+	settings := map[string]string{
+		"PRODUCT_NAME": "My App",
+		"TARGET_NAME":  "App",
+		"BUNDLE_ROOT":  "io.bitrise.${TARGET_NAME:lower}",
+	}
+	lookup := func(key string) string { return settings[key] }
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "io.bitrise.$(PRODUCT_NAME:rfc1034identifier)", want: "io.bitrise.My-App"},
+		{value: "$(BUNDLE_ROOT).widget", want: "io.bitrise.app.widget"},
+		{value: "$(PRODUCT_NAME:c99extidentifier)", want: "My_App"},
+		{value: "$(UNDEFINED)suffix", want: "suffix"},
+		{value: "no references", want: "no references"},
+	}
+	for _, tt := range tests {
+		if got := expandBuildSettingReferences(tt.value, lookup, 0); got != tt.want {
+			t.Errorf("expandBuildSettingReferences(%s) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMergeBuildSettings(t *testing.T) {
+	projectSettings := serialized.Object{
+		"SDKROOT":                      "macosx",
+		"OTHER_SWIFT_FLAGS":            "-DCI",
+		"LD_RUNPATH_SEARCH_PATHS":      []interface{}{"@executable_path/../Frameworks"},
+		"GCC_PREPROCESSOR_DEFINITIONS": "DEBUG=1",
+	}
+	targetSettings := serialized.Object{
+		"OTHER_SWIFT_FLAGS":                         "$(inherited) -DAPP",
+		"LD_RUNPATH_SEARCH_PATHS":                   []interface{}{"$(inherited)", "@loader_path/Frameworks"},
+		"GCC_PREPROCESSOR_DEFINITIONS[sdk=macosx*]": []interface{}{"${inherited}", "MAC=1"},
+		"PRODUCT_NAME":                              "$(inherited)",
+	}
+
+	got := mergeBuildSettings(projectSettings, targetSettings)
+	want := serialized.Object{
+		"SDKROOT":                                   "macosx",
+		"OTHER_SWIFT_FLAGS":                         "-DCI -DAPP",
+		"LD_RUNPATH_SEARCH_PATHS":                   []interface{}{"@executable_path/../Frameworks", "@loader_path/Frameworks"},
+		"GCC_PREPROCESSOR_DEFINITIONS":              "DEBUG=1",
+		"GCC_PREPROCESSOR_DEFINITIONS[sdk=macosx*]": []interface{}{"DEBUG=1", "MAC=1"},
+		"PRODUCT_NAME":                              "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeBuildSettings() = %v, want %v", got, want)
+	}
+}
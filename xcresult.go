@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-xcode/plistutil"
+)
+
+// xcresultDateLayout is the format of the Date values in the xcresulttool JSON output.
+const xcresultDateLayout = "2006-01-02T15:04:05.000-0700"
+
+const (
+	xcresultSeverityError           = "error"
+	xcresultSeverityWarning         = "warning"
+	xcresultSeverityAnalyzerWarning = "analyzer warning"
+)
+
+// xcresultIssue is an error, warning or analyzer warning of a result bundle.
+type xcresultIssue struct {
+	Severity string `json:"severity"`
+	Type     string `json:"type"`
+	Message  string `json:"message"`
+	// Location is the issue's file and line, e.g. `/work/App/AppDelegate.swift:12`.
+	Location string `json:"location,omitempty"`
+}
+
+func (i xcresultIssue) String() string {
+	if i.Location == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Location, i.Severity, i.Message)
+}
+
+// xcresultAction is an action (e.g. Archive) of a result bundle with its timing.
+type xcresultAction struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Started  time.Time     `json:"started"`
+	Ended    time.Time     `json:"ended"`
+	Duration time.Duration `json:"duration"`
+}
+
+// xcresultSummary is the issue summaries and the action timing of a result bundle.
+type xcresultSummary struct {
+	Issues  []xcresultIssue  `json:"issues"`
+	Actions []xcresultAction `json:"actions"`
+}
+
+// IssuesWithSeverity returns the issues with the given severity.
+func (s xcresultSummary) IssuesWithSeverity(severity string) []xcresultIssue {
+	var issues []xcresultIssue
+	for _, issue := range s.Issues {
+		if issue.Severity == severity {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// failureMessage returns the errors of the result bundle, or an empty string if it has no error.
+func (s xcresultSummary) failureMessage() string {
+	errors := s.IssuesWithSeverity(xcresultSeverityError)
+	if len(errors) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(errors))
+	for _, issue := range errors {
+		lines = append(lines, "- "+issue.String())
+	}
+	return fmt.Sprintf("%d error(s):\n%s", len(errors), strings.Join(lines, "\n"))
+}
+
+// The xcresulttool JSON output wraps every value in an object with its type, e.g. `{"_type": {"_name": "String"}, "_value": "Archive"}`.
+type xcresultValue struct {
+	Value string `json:"_value"`
+}
+
+type xcresultActionsInvocationRecord struct {
+	Actions struct {
+		Values []xcresultActionRecord `json:"_values"`
+	} `json:"actions"`
+	Issues xcresultIssueSummaries `json:"issues"`
+}
+
+type xcresultActionRecord struct {
+	SchemeCommandName xcresultValue `json:"schemeCommandName"`
+	StartedTime       xcresultValue `json:"startedTime"`
+	EndedTime         xcresultValue `json:"endedTime"`
+	ActionResult      struct {
+		Status xcresultValue `json:"status"`
+	} `json:"actionResult"`
+}
+
+type xcresultIssueSummaries struct {
+	ErrorSummaries           xcresultIssueSummaryArray `json:"errorSummaries"`
+	WarningSummaries         xcresultIssueSummaryArray `json:"warningSummaries"`
+	AnalyzerWarningSummaries xcresultIssueSummaryArray `json:"analyzerWarningSummaries"`
+}
+
+type xcresultIssueSummaryArray struct {
+	Values []xcresultIssueSummary `json:"_values"`
+}
+
+type xcresultIssueSummary struct {
+	IssueType                           xcresultValue `json:"issueType"`
+	Message                             xcresultValue `json:"message"`
+	DocumentLocationInCreatingWorkspace struct {
+		URL xcresultValue `json:"url"`
+	} `json:"documentLocationInCreatingWorkspace"`
+}
+
+// xcresultLoader returns the root object (ActionsInvocationRecord) of the result bundle as JSON.
+type xcresultLoader func(bundlePth string) ([]byte, error)
+
+// xcresultToolLoader loads the result bundle with xcresulttool, Xcode 16 and later requires the legacy flag for the JSON format.
+func xcresultToolLoader(legacy bool) xcresultLoader {
+	return func(bundlePth string) ([]byte, error) {
+		args := []string{"xcresulttool", "get", "--format", "json", "--path", bundlePth}
+		if legacy {
+			args = append(args, "--legacy")
+		}
+
+		out, err := command.New("xcrun", args...).RunAndReturnTrimmedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("xcresulttool failed: %s, output: %s", err, out)
+		}
+		return []byte(out), nil
+	}
+}
+
+// readXCResult returns the issue summaries and the action timing of the result bundle.
+func readXCResult(bundlePth string, load xcresultLoader) (xcresultSummary, error) {
+	if _, err := plistutil.NewPlistDataFromFile(filepath.Join(bundlePth, "Info.plist")); err != nil {
+		return xcresultSummary{}, fmt.Errorf("%s is not a result bundle: %s", bundlePth, err)
+	}
+
+	content, err := load(bundlePth)
+	if err != nil {
+		return xcresultSummary{}, err
+	}
+	return parseXCResult(content)
+}
+
+func parseXCResult(content []byte) (xcresultSummary, error) {
+	var record xcresultActionsInvocationRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return xcresultSummary{}, fmt.Errorf("failed to parse the result bundle: %s", err)
+	}
+
+	var summary xcresultSummary
+	for _, issues := range []struct {
+		severity  string
+		summaries []xcresultIssueSummary
+	}{
+		{severity: xcresultSeverityError, summaries: record.Issues.ErrorSummaries.Values},
+		{severity: xcresultSeverityWarning, summaries: record.Issues.WarningSummaries.Values},
+		{severity: xcresultSeverityAnalyzerWarning, summaries: record.Issues.AnalyzerWarningSummaries.Values},
+	} {
+		for _, issue := range issues.summaries {
+			summary.Issues = append(summary.Issues, xcresultIssue{
+				Severity: issues.severity,
+				Type:     issue.IssueType.Value,
+				Message:  issue.Message.Value,
+				Location: xcresultIssueLocation(issue.DocumentLocationInCreatingWorkspace.URL.Value),
+			})
+		}
+	}
+
+	for _, action := range record.Actions.Values {
+		started, err := time.Parse(xcresultDateLayout, action.StartedTime.Value)
+		if err != nil {
+			return xcresultSummary{}, fmt.Errorf("invalid start time of the %s action: %s", action.SchemeCommandName.Value, err)
+		}
+		ended, err := time.Parse(xcresultDateLayout, action.EndedTime.Value)
+		if err != nil {
+			return xcresultSummary{}, fmt.Errorf("invalid end time of the %s action: %s", action.SchemeCommandName.Value, err)
+		}
+
+		summary.Actions = append(summary.Actions, xcresultAction{
+			Name:     action.SchemeCommandName.Value,
+			Status:   action.ActionResult.Status.Value,
+			Started:  started,
+			Ended:    ended,
+			Duration: ended.Sub(started),
+		})
+	}
+
+	return summary, nil
+}
+
+// xcresultIssueLocation converts a document location URL
+// (`file:///work/App/AppDelegate.swift#CharacterRangeLen=0&EndingLineNumber=11&StartingLineNumber=11`)
+// to a `path:line` location, the line numbers of the URL are zero based.
+func xcresultIssueLocation(documentURL string) string {
+	if documentURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(documentURL)
+	if err != nil || u.Path == "" {
+		return documentURL
+	}
+
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err != nil {
+		return u.Path
+	}
+	line, err := strconv.Atoi(fragment.Get("StartingLineNumber"))
+	if err != nil {
+		return u.Path
+	}
+	return fmt.Sprintf("%s:%d", u.Path, line+1)
+}
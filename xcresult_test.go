@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func fixtureXCResultLoader(t *testing.T) xcresultLoader {
+	return func(bundlePth string) ([]byte, error) {
+		if bundlePth != "testdata/Archive.xcresult" {
+			t.Fatalf("unexpected result bundle: %s", bundlePth)
+		}
+		return os.ReadFile("testdata/Archive.xcresult.json")
+	}
+}
+
+func TestReadXCResult(t *testing.T) {
+	got, err := readXCResult("testdata/Archive.xcresult", fixtureXCResultLoader(t))
+	if err != nil {
+		t.Fatalf("readXCResult() error = %s", err)
+	}
+
+	wantIssues := []xcresultIssue{
+		{Severity: xcresultSeverityError, Type: "Swift Compiler Error", Message: "Cannot find 'NSApp' in scope", Location: "/work/App/AppDelegate.swift:12"},
+		{Severity: xcresultSeverityError, Type: "Code Signing Error", Message: `No signing certificate "Developer ID Application" found`},
+		{Severity: xcresultSeverityWarning, Type: "Deprecation", Message: "'launchApplication' was deprecated in macOS 11.0"},
+		{Severity: xcresultSeverityAnalyzerWarning, Type: "Dead store", Message: "Value stored to 'count' is never read"},
+	}
+	if !reflect.DeepEqual(got.Issues, wantIssues) {
+		t.Errorf("Issues = %+v, want %+v", got.Issues, wantIssues)
+	}
+
+	if len(got.Actions) != 1 {
+		t.Fatalf("got %d actions, want 1", len(got.Actions))
+	}
+	action := got.Actions[0]
+	if action.Name != "Archive" || action.Status != "failed" || action.Duration != 91500*time.Millisecond {
+		t.Errorf("action = %+v, want a failed Archive action of 1m31.5s", action)
+	}
+	if want := time.Date(2023, 9, 25, 8, 12, 31, 12000000, time.UTC); !action.Started.Equal(want) {
+		t.Errorf("Started = %s, want %s", action.Started, want)
+	}
+
+	wantMessage := `2 error(s):
+- /work/App/AppDelegate.swift:12: error: Cannot find 'NSApp' in scope
+- error: No signing certificate "Developer ID Application" found`
+	if message := got.failureMessage(); message != wantMessage {
+		t.Errorf("failureMessage() = %s, want %s", message, wantMessage)
+	}
+	if message := (xcresultSummary{}).failureMessage(); message != "" {
+		t.Errorf("failureMessage() = %s, want empty for a result bundle without errors", message)
+	}
+}
+
+func TestReadXCResultNotABundle(t *testing.T) {
+	if _, err := readXCResult(t.TempDir(), fixtureXCResultLoader(t)); err == nil {
+		t.Errorf("readXCResult() expected error for a directory without Info.plist")
+	}
+}
+
+func TestXCResultIssueString(t *testing.T) {
+	issue := xcresultIssue{Severity: xcresultSeverityError, Message: "Cannot find 'NSApp' in scope", Location: "/work/App/AppDelegate.swift:12"}
+	if got, want := issue.String(), "/work/App/AppDelegate.swift:12: error: Cannot find 'NSApp' in scope"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
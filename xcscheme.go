@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// xcodeScheme is an .xcscheme file of a project or workspace.
+type xcodeScheme struct {
+	Name          string
+	Path          string
+	ContainerPath string
+	IsShared      bool
+
+	BuildAction   xcschemeBuildAction   `xml:"BuildAction"`
+	ArchiveAction xcschemeArchiveAction `xml:"ArchiveAction"`
+}
+
+type xcschemeBuildAction struct {
+	Entries []xcschemeBuildActionEntry `xml:"BuildActionEntries>BuildActionEntry"`
+}
+
+type xcschemeBuildActionEntry struct {
+	BuildForArchiving  string             `xml:"buildForArchiving,attr"`
+	BuildableReference buildableReference `xml:"BuildableReference"`
+}
+
+type xcschemeArchiveAction struct {
+	BuildConfiguration string `xml:"buildConfiguration,attr"`
+}
+
+// buildableReference points to a target of a project, e.g. container:App.xcodeproj.
+type buildableReference struct {
+	BlueprintIdentifier string `xml:"BlueprintIdentifier,attr"`
+	BuildableName       string `xml:"BuildableName,attr"`
+	BlueprintName       string `xml:"BlueprintName,attr"`
+	ReferencedContainer string `xml:"ReferencedContainer,attr"`
+}
+
+// HasArchiveAction returns true if the scheme defines an Archive action.
+func (s xcodeScheme) HasArchiveAction() bool {
+	return s.ArchiveAction.BuildConfiguration != ""
+}
+
+// ArchivableReferences returns the buildable references built when the scheme is archived.
+func (s xcodeScheme) ArchivableReferences() []buildableReference {
+	var references []buildableReference
+	for _, entry := range s.BuildAction.Entries {
+		if entry.BuildForArchiving == "YES" {
+			references = append(references, entry.BuildableReference)
+		}
+	}
+	return references
+}
+
+// ContainerPath returns the path of the project the reference points to.
+// Relative containers are resolved against the directory of the scheme's project or workspace.
+func (r buildableReference) ContainerPath(baseDir string) string {
+	if strings.HasPrefix(r.ReferencedContainer, "absolute:") {
+		return strings.TrimPrefix(r.ReferencedContainer, "absolute:")
+	}
+	return filepath.Join(baseDir, strings.TrimPrefix(r.ReferencedContainer, "container:"))
+}
+
+// parseXcodeScheme parses the given .xcscheme file.
+func parseXcodeScheme(pth string) (xcodeScheme, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return xcodeScheme{}, err
+	}
+
+	var scheme xcodeScheme
+	if err := xml.Unmarshal(content, &scheme); err != nil {
+		return xcodeScheme{}, fmt.Errorf("failed to parse %s: %s", pth, err)
+	}
+	scheme.Name = strings.TrimSuffix(filepath.Base(pth), filepath.Ext(pth))
+	scheme.Path = pth
+
+	return scheme, nil
+}
+
+// xcodeSchemes returns the shared and the user schemes of the given .xcodeproj or .xcworkspace,
+// the shared schemes first, both sorted by name.
+func xcodeSchemes(containerPth string) ([]xcodeScheme, error) {
+	sharedPths, err := filepath.Glob(filepath.Join(containerPth, "xcshareddata", "xcschemes", "*.xcscheme"))
+	if err != nil {
+		return nil, err
+	}
+	userPths, err := filepath.Glob(filepath.Join(containerPth, "xcuserdata", "*.xcuserdatad", "xcschemes", "*.xcscheme"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sharedPths)
+	sort.Strings(userPths)
+
+	var schemes []xcodeScheme
+	for _, pths := range [][]string{sharedPths, userPths} {
+		for _, pth := range pths {
+			scheme, err := parseXcodeScheme(pth)
+			if err != nil {
+				return nil, err
+			}
+			scheme.ContainerPath = containerPth
+			scheme.IsShared = len(schemes) < len(sharedPths)
+			schemes = append(schemes, scheme)
+		}
+	}
+
+	return schemes, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestXcodeSchemes(t *testing.T) {
+	schemes, err := xcodeSchemes("testdata/App.xcodeproj")
+	if err != nil {
+		t.Fatalf("xcodeSchemes() error = %s", err)
+	}
+	if len(schemes) != 2 {
+		t.Fatalf("xcodeSchemes() returned %d schemes, want 2", len(schemes))
+	}
+
+	app := schemes[0]
+	if app.Name != "App" || !app.IsShared {
+		t.Errorf("schemes[0] = %s (shared: %t), want shared App", app.Name, app.IsShared)
+	}
+	if !app.HasArchiveAction() || app.ArchiveAction.BuildConfiguration != "Release" {
+		t.Errorf("archive configuration = %s, want Release", app.ArchiveAction.BuildConfiguration)
+	}
+
+	wantReferences := []buildableReference{{
+		BlueprintIdentifier: "A10000000000000000000002",
+		BuildableName:       "App.app",
+		BlueprintName:       "App",
+		ReferencedContainer: "container:App.xcodeproj",
+	}}
+	if got := app.ArchivableReferences(); !reflect.DeepEqual(got, wantReferences) {
+		t.Errorf("ArchivableReferences() = %v, want %v", got, wantReferences)
+	}
+
+	widget := schemes[1]
+	if widget.Name != "Widget" || widget.IsShared {
+		t.Errorf("schemes[1] = %s (shared: %t), want user scheme Widget", widget.Name, widget.IsShared)
+	}
+}
+
+func TestBuildableReferenceContainerPath(t *testing.T) {
+	tests := []struct {
+		container string
+		want      string
+	}{
+		{container: "container:App.xcodeproj", want: "/project/App.xcodeproj"},
+		{container: "container:Sub/Lib.xcodeproj", want: "/project/Sub/Lib.xcodeproj"},
+		{container: "absolute:/other/Lib.xcodeproj", want: "/other/Lib.xcodeproj"},
+	}
+	for _, tt := range tests {
+		reference := buildableReference{ReferencedContainer: tt.container}
+		if got := reference.ContainerPath("/project"); got != tt.want {
+			t.Errorf("ContainerPath(%s) = %v, want %v", tt.container, got, tt.want)
+		}
+	}
+}
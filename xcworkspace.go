@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// xcworkspaceGroup is a Group element of the contents.xcworkspacedata, the root Workspace element included.
+type xcworkspaceGroup struct {
+	Location string             `xml:"location,attr"`
+	FileRefs []xcworkspaceFile  `xml:"FileRef"`
+	Groups   []xcworkspaceGroup `xml:"Group"`
+}
+
+type xcworkspaceFile struct {
+	Location string `xml:"location,attr"`
+}
+
+// workspaceProjectPaths returns the paths of the projects referenced by the workspace's contents.xcworkspacedata.
+func workspaceProjectPaths(workspacePth string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(workspacePth, "contents.xcworkspacedata"))
+	if err != nil {
+		return nil, err
+	}
+
+	var workspace xcworkspaceGroup
+	if err := xml.Unmarshal(content, &workspace); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", workspacePth, err)
+	}
+
+	workspaceDir := filepath.Dir(workspacePth)
+	return groupProjectPaths(workspace, workspaceDir, workspaceDir), nil
+}
+
+func groupProjectPaths(group xcworkspaceGroup, groupDir, workspaceDir string) []string {
+	var pths []string
+	for _, file := range group.FileRefs {
+		if pth := resolveWorkspaceLocation(file.Location, groupDir, workspaceDir); filepath.Ext(pth) == ".xcodeproj" {
+			pths = append(pths, pth)
+		}
+	}
+	for _, subgroup := range group.Groups {
+		subgroupDir := resolveWorkspaceLocation(subgroup.Location, groupDir, workspaceDir)
+		pths = append(pths, groupProjectPaths(subgroup, subgroupDir, workspaceDir)...)
+	}
+	return pths
+}
+
+// resolveWorkspaceLocation resolves a workspace location, like `group:App/App.xcodeproj`, to a path.
+func resolveWorkspaceLocation(location, groupDir, workspaceDir string) string {
+	split := strings.SplitN(location, ":", 2)
+	if len(split) != 2 {
+		return groupDir
+	}
+
+	switch split[0] {
+	case "absolute":
+		return split[1]
+	case "container":
+		return filepath.Join(workspaceDir, split[1])
+	case "self":
+		// The workspace embedded in a project refers to its project.
+		return workspaceDir
+	default:
+		return filepath.Join(groupDir, split[1])
+	}
+}
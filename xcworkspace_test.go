@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorkspaceProjectPaths(t *testing.T) {
+	got, err := workspaceProjectPaths("testdata/App.xcworkspace")
+	if err != nil {
+		t.Fatalf("workspaceProjectPaths() error = %s", err)
+	}
+
+	want := []string{"testdata/App.xcodeproj", "testdata/Vendor/Lib/Lib.xcodeproj"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("workspaceProjectPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveWorkspaceLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{location: "group:App.xcodeproj", want: "/group/App.xcodeproj"},
+		{location: "container:App.xcodeproj", want: "/workspace/App.xcodeproj"},
+		{location: "absolute:/other/App.xcodeproj", want: "/other/App.xcodeproj"},
+		{location: "self:", want: "/workspace"},
+	}
+	for _, tt := range tests {
+		if got := resolveWorkspaceLocation(tt.location, "/group", "/workspace"); got != tt.want {
+			t.Errorf("resolveWorkspaceLocation(%s) = %v, want %v", tt.location, got, tt.want)
+		}
+	}
+}
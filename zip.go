@@ -0,0 +1,350 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/output"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	appleDoubleDirName = "__MACOSX"
+
+	finderInfoXattrName   = "com.apple.FinderInfo"
+	resourceForkXattrName = "com.apple.ResourceFork"
+)
+
+// zipEntryModTime is the fixed modification time of every zip entry, it makes the archives reproducible.
+var zipEntryModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// zipOptions configures the archives created by writeZip.
+type zipOptions struct {
+	// CompressionLevel is the deflate compression level (0-9), 0 stores the entries without compression.
+	CompressionLevel int
+	// PreserveXattrs stores the extended attributes in AppleDouble (__MACOSX/._*) entries, the way ditto does.
+	PreserveXattrs bool
+}
+
+type zipEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+type appleDoubleZipEntry struct {
+	name    string
+	content []byte
+}
+
+// zipAndExportOutput zips the given files or directories with writeZip, moves the archive
+// to the destination path and exports the destination path with envman.
+func zipAndExportOutput(sourcePths []string, destinationZipPth, envKey string, opts zipOptions) error {
+	defer stepMetrics.measure(phaseZip, time.Now())
+
+	tmpDir, err := stepLifecycle.tempDir("__export_tmp_dir__")
+	if err != nil {
+		return err
+	}
+
+	tmpZipFilePth := filepath.Join(tmpDir, "temp-zip-file.zip")
+	if err := writeZip(sourcePths, tmpZipFilePth, opts); err != nil {
+		return err
+	}
+
+	return output.ExportOutputFile(tmpZipFilePth, destinationZipPth, envKey)
+}
+
+// writeZip creates a reproducible zip archive from the given files and directories.
+// Like `ditto -c -k --keepParent`, every source is stored under its own base name,
+// symlinks are stored as links and the Unix permissions are kept.
+// Entries are sorted by name and get a fixed modification time.
+func writeZip(sourcePths []string, destinationZipPth string, opts zipOptions) (err error) {
+	if len(sourcePths) == 0 {
+		return fmt.Errorf("source path list is empty")
+	}
+
+	var entries []zipEntry
+	for _, sourcePth := range sourcePths {
+		sourceEntries, err := collectZipEntries(sourcePth)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, sourceEntries...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	f, err := os.Create(destinationZipPth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	w := zip.NewWriter(f)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, opts.CompressionLevel)
+	})
+
+	var appleDoubleEntries []appleDoubleZipEntry
+	for _, entry := range entries {
+		if err := writeZipEntry(w, entry, opts); err != nil {
+			return fmt.Errorf("failed to add %s to the zip: %s", entry.path, err)
+		}
+
+		if opts.PreserveXattrs {
+			appleDouble, err := appleDoubleEntry(entry)
+			if err != nil {
+				return fmt.Errorf("failed to read extended attributes of %s: %s", entry.path, err)
+			}
+			if appleDouble != nil {
+				appleDoubleEntries = append(appleDoubleEntries, *appleDouble)
+			}
+		}
+	}
+
+	if len(appleDoubleEntries) > 0 {
+		if err := writeAppleDoubleEntries(w, appleDoubleEntries, opts); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func collectZipEntries(sourcePth string) ([]zipEntry, error) {
+	sourcePth = strings.TrimSuffix(sourcePth, "/")
+	parentDir := filepath.Dir(sourcePth)
+
+	var entries []zipEntry
+	err := filepath.WalkDir(sourcePth, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Lstat(pth)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(parentDir, pth)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			name += "/"
+		}
+
+		entries = append(entries, zipEntry{name: name, path: pth, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %s", sourcePth, err)
+	}
+
+	return entries, nil
+}
+
+func newZipFileHeader(name string, mode fs.FileMode, opts zipOptions) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:     name,
+		Modified: zipEntryModTime,
+		Method:   zip.Store,
+	}
+	header.SetMode(mode)
+
+	if mode.IsRegular() && opts.CompressionLevel != flate.NoCompression {
+		header.Method = zip.Deflate
+	}
+
+	return header
+}
+
+func writeZipEntry(w *zip.Writer, entry zipEntry, opts zipOptions) error {
+	header := newZipFileHeader(entry.name, entry.info.Mode(), opts)
+
+	writer, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry.info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(entry.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(writer, target)
+		return err
+	case entry.info.Mode().IsRegular():
+		f, err := os.Open(entry.path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Warnf("Failed to close %s, error: %s", entry.path, err)
+			}
+		}()
+
+		_, err = io.Copy(writer, f)
+		return err
+	default:
+		return nil
+	}
+}
+
+// appleDoubleEntry returns the AppleDouble entry holding the extended attributes of the given entry,
+// or nil if it has no extended attributes.
+func appleDoubleEntry(entry zipEntry) (*appleDoubleZipEntry, error) {
+	xattrs, err := readXattrs(entry.path, entry.info.Mode()&fs.ModeSymlink != 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(xattrs) == 0 {
+		return nil, nil
+	}
+
+	dir, base := path.Split(strings.TrimSuffix(entry.name, "/"))
+	return &appleDoubleZipEntry{
+		name:    appleDoubleDirName + "/" + dir + "._" + base,
+		content: encodeAppleDouble(xattrs),
+	}, nil
+}
+
+func writeAppleDoubleEntries(w *zip.Writer, entries []appleDoubleZipEntry, opts zipOptions) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	writtenDirs := map[string]bool{}
+	for _, entry := range entries {
+		var dirs []string
+		for dir, _ := path.Split(entry.name); dir != "" && !writtenDirs[dir]; dir, _ = path.Split(strings.TrimSuffix(dir, "/")) {
+			writtenDirs[dir] = true
+			dirs = append([]string{dir}, dirs...)
+		}
+		for _, dir := range dirs {
+			if _, err := w.CreateHeader(newZipFileHeader(dir, fs.ModeDir|0755, opts)); err != nil {
+				return err
+			}
+		}
+
+		writer, err := w.CreateHeader(newZipFileHeader(entry.name, 0644, opts))
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeAppleDouble encodes the extended attributes in the AppleDouble format used by macOS
+// for storing metadata on filesystems (and in archives) without native extended attribute support.
+func encodeAppleDouble(xattrs map[string][]byte) []byte {
+	const (
+		appleDoubleMagic   = 0x00051607
+		appleDoubleVersion = 0x00020000
+		attrHeaderMagic    = 0x41545452 // 'ATTR'
+
+		entryIDResourceFork = 2
+		entryIDFinderInfo   = 9
+
+		finderInfoOffset = 50
+		finderInfoSize   = 32
+		attrHeaderSize   = 120
+	)
+
+	finderInfo := make([]byte, finderInfoSize)
+	copy(finderInfo, xattrs[finderInfoXattrName])
+	resourceFork := xattrs[resourceForkXattrName]
+
+	var names []string
+	for name := range xattrs {
+		if name == finderInfoXattrName || name == resourceForkXattrName {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entriesSize := 0
+	for _, name := range names {
+		entriesSize += appleDoubleAttrEntrySize(name)
+	}
+	dataStart := attrHeaderSize + entriesSize
+	dataLength := 0
+	for _, name := range names {
+		dataLength += len(xattrs[name])
+	}
+	totalSize := dataStart + dataLength
+
+	var b bytes.Buffer
+	write := func(v interface{}) {
+		// writing to a bytes.Buffer never fails
+		_ = binary.Write(&b, binary.BigEndian, v)
+	}
+
+	write(uint32(appleDoubleMagic))
+	write(uint32(appleDoubleVersion))
+	b.WriteString("Mac OS X        ")
+	write(uint16(2))
+	write([]uint32{entryIDFinderInfo, finderInfoOffset, uint32(totalSize - finderInfoOffset)})
+	write([]uint32{entryIDResourceFork, uint32(totalSize), uint32(len(resourceFork))})
+	b.Write(finderInfo)
+	write(uint16(0)) // padding
+
+	write(uint32(attrHeaderMagic))
+	write(uint32(0)) // debug tag
+	write(uint32(totalSize))
+	write(uint32(dataStart))
+	write(uint32(dataLength))
+	write([]uint32{0, 0, 0}) // reserved
+	write(uint16(0))         // flags
+	write(uint16(len(names)))
+
+	offset := dataStart
+	for _, name := range names {
+		entryStart := b.Len()
+		write(uint32(offset))
+		write(uint32(len(xattrs[name])))
+		write(uint16(0)) // flags
+		write(uint8(len(name) + 1))
+		b.WriteString(name)
+		b.WriteByte(0)
+		for b.Len()-entryStart < appleDoubleAttrEntrySize(name) {
+			b.WriteByte(0)
+		}
+		offset += len(xattrs[name])
+	}
+
+	for _, name := range names {
+		b.Write(xattrs[name])
+	}
+	b.Write(resourceFork)
+
+	return b.Bytes()
+}
+
+// appleDoubleAttrEntrySize returns the 4 byte aligned size of an attribute entry:
+// offset (4) + length (4) + flags (2) + name length (1) + NULL terminated name.
+func appleDoubleAttrEntrySize(name string) int {
+	return (11 + len(name) + 1 + 3) &^ 3
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func createTestBundle(t *testing.T) string {
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "My.framework")
+
+	for _, d := range []string{"Versions/A/Resources"} {
+		if err := os.MkdirAll(filepath.Join(bundle, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "Versions/A/My"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "Versions/A/Resources/Info.plist"), []byte("plist"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("A", filepath.Join(bundle, "Versions/Current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("Versions/Current/My", filepath.Join(bundle, "My")); err != nil {
+		t.Fatal(err)
+	}
+
+	return bundle
+}
+
+func TestWriteZipPreservesSymlinksAndModes(t *testing.T) {
+	bundle := createTestBundle(t)
+	zipPth := filepath.Join(t.TempDir(), "out.zip")
+
+	if err := writeZip([]string{bundle}, zipPth, zipOptions{CompressionLevel: 6}); err != nil {
+		t.Fatalf("writeZip() error = %s", err)
+	}
+
+	r, err := zip.OpenReader(zipPth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var names []string
+	files := map[string]*zip.File{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		files[f.Name] = f
+
+		if !f.Modified.Equal(zipEntryModTime) {
+			t.Errorf("%s modified = %s, want %s", f.Name, f.Modified, zipEntryModTime)
+		}
+	}
+
+	wantNames := []string{
+		"My.framework/",
+		"My.framework/My",
+		"My.framework/Versions/",
+		"My.framework/Versions/A/",
+		"My.framework/Versions/A/My",
+		"My.framework/Versions/A/Resources/",
+		"My.framework/Versions/A/Resources/Info.plist",
+		"My.framework/Versions/Current",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("zip entries = %v, want %v", names, wantNames)
+	}
+
+	link := files["My.framework/Versions/Current"]
+	if link.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Versions/Current mode = %s, want symlink", link.Mode())
+	}
+	rc, err := link.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(target) != "A" {
+		t.Errorf("Versions/Current target = %s, want A", target)
+	}
+
+	if mode := files["My.framework/Versions/A/My"].Mode().Perm(); mode != 0755 {
+		t.Errorf("binary mode = %s, want %s", mode, fs.FileMode(0755))
+	}
+	if mode := files["My.framework/Versions/A/Resources/Info.plist"].Mode().Perm(); mode != 0644 {
+		t.Errorf("Info.plist mode = %s, want %s", mode, fs.FileMode(0644))
+	}
+}
+
+func TestWriteZipIsReproducible(t *testing.T) {
+	bundle := createTestBundle(t)
+	outDir := t.TempDir()
+
+	var contents [][]byte
+	for i, name := range []string{"first.zip", "second.zip"} {
+		if i == 1 {
+			// touching a file must not change the output
+			if err := os.Chtimes(filepath.Join(bundle, "Versions/A/My"), zipEntryModTime, zipEntryModTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pth := filepath.Join(outDir, name)
+		if err := writeZip([]string{bundle}, pth, zipOptions{CompressionLevel: 9}); err != nil {
+			t.Fatalf("writeZip() error = %s", err)
+		}
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+	}
+
+	if !bytes.Equal(contents[0], contents[1]) {
+		t.Errorf("writeZip() output differs between runs")
+	}
+}
+
+func TestWriteZipIsIndependentOfTheSourceLocation(t *testing.T) {
+	outDir := t.TempDir()
+
+	var contents [][]byte
+	for _, name := range []string{"first.zip", "second.zip"} {
+		// the dSYMs are copied to a dSYMs dir of a new temp dir on every run
+		dsymDir := filepath.Join(t.TempDir(), "dSYMs")
+		if err := os.Mkdir(dsymDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(createTestBundle(t), filepath.Join(dsymDir, "My.framework")); err != nil {
+			t.Fatal(err)
+		}
+
+		pth := filepath.Join(outDir, name)
+		if err := writeZip([]string{dsymDir}, pth, zipOptions{CompressionLevel: 9}); err != nil {
+			t.Fatalf("writeZip() error = %s", err)
+		}
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+	}
+
+	if !bytes.Equal(contents[0], contents[1]) {
+		t.Errorf("writeZip() output depends on the location of the zipped dir")
+	}
+}
+
+func TestEncodeAppleDouble(t *testing.T) {
+	content := encodeAppleDouble(map[string][]byte{
+		"com.apple.quarantine": []byte("0081;"),
+		finderInfoXattrName:    {1, 2, 3},
+	})
+
+	if magic := binary.BigEndian.Uint32(content[0:4]); magic != 0x00051607 {
+		t.Errorf("magic = %x", magic)
+	}
+	if finderInfo := content[50:53]; !bytes.Equal(finderInfo, []byte{1, 2, 3}) {
+		t.Errorf("finder info = %v", finderInfo)
+	}
+	if attrMagic := string(content[84:88]); attrMagic != "ATTR" {
+		t.Errorf("attr header magic = %s", attrMagic)
+	}
+	if totalSize := binary.BigEndian.Uint32(content[92:96]); int(totalSize) != len(content) {
+		t.Errorf("total size = %d, want %d", totalSize, len(content))
+	}
+	if numAttrs := binary.BigEndian.Uint16(content[118:120]); numAttrs != 1 {
+		t.Errorf("attribute count = %d, want 1", numAttrs)
+	}
+
+	dataStart := binary.BigEndian.Uint32(content[120:124])
+	dataLength := binary.BigEndian.Uint32(content[124:128])
+	if got := string(content[dataStart : dataStart+dataLength]); got != "0081;" {
+		t.Errorf("attribute value = %s", got)
+	}
+	if name := string(content[131 : 131+len("com.apple.quarantine")]); name != "com.apple.quarantine" {
+		t.Errorf("attribute name = %s", name)
+	}
+}